@@ -1,7 +1,13 @@
 package d2protocolparser
 
 import (
-	"os"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
 
 	"io"
 
@@ -15,18 +21,34 @@ import (
 )
 
 // Protocol represents the Dofus 2 Protocol and contains
-// every messages and types
+// every messages and types. A Protocol returned by Build or LoadProtocol is
+// read-only: its lookups are indexed on first use and the index is the only
+// state that changes afterwards, it is safe for concurrent use.
 type Protocol struct {
 	Messages []Class
 	Types    []Class
 	Enums    []Enum
 	Version  Version
+
+	// SourceHash is the hex encoded SHA-256 of the DofusInvoker.swf the
+	// protocol was built from, it is empty when the file was not read by
+	// the builder
+	SourceHash string `json:",omitempty"`
+
+	// Filtered is set when the protocol was built with SkipTypes, SkipEnums
+	// or a NamespaceFilter, the field types are then not all part of it
+	Filtered bool `json:",omitempty"`
+
+	index *protocolIndex
 }
 
 // Enum represents a Dofus 2 Protocol Enumeration Class
 type Enum struct {
-	Name   string
-	Values []EnumValue
+	Name       string
+	Values     []EnumValue
+	Underlying string // Underlying is the AS3 type of the values, int or uint
+	IsFlags    bool   // IsFlags is set when the values are bits meant to be combined, see isFlagSet
+	BaseType   string // BaseType is the smallest integer type holding every value, like uint8 or int16, see enumBaseType
 }
 
 // EnumValue represents a single Enumeration Values
@@ -43,24 +65,59 @@ type Class struct {
 	Fields      []Field
 	ProtocolID  uint16
 	UseHashFunc bool
+	HashFunc    string // HashFunc is the property of HASH_FUNCTION that pack calls, empty when it calls HASH_FUNCTION itself
+	HashKey     []byte // HashKey is the string held by HASH_FUNCTION, nil when it is a Function like in the official clients
+
+	// IsContainer is set when the content of the class is a byte array that
+	// holds other messages, like NetworkDataContainerMessage whose content is
+	// a compressed sequence of messages. The content field can be decoded as
+	// embedded raw sub-messages.
+	IsContainer bool
+
+	// Abstract is set when the class has no protocol id, it is only a parent
+	// of other classes and is never sent on its own
+	Abstract bool
+
+	// Metadata holds the AS3 metadata tags of the class, like [Deprecated],
+	// by tag name. Each item of a tag is its value, prefixed with its key and
+	// = when it has one.
+	Metadata map[string][]string `json:",omitempty"`
 }
 
 // Field represents a class field
 type Field struct {
 	Name        string
 	Type        string
+	RawType     string // RawType is the AS3 type of the field, or of its elements for vectors, before reduction
 	WriteMethod string
+	ReadMethod  string // ReadMethod is the counterpart of WriteMethod used to deserialize the field
 	Method      string // Method contains the name of the method that should be used for scalar types
+	IsVarLength bool   // IsVarLength is set when the scalar is written with a writeVar method
 
 	IsVector          bool
-	IsDynamicLength   bool
+	VectorDepth       int  // VectorDepth is the number of nested vectors, 2 for Vector.<Vector.<T>>
+	IsDynamicLength   bool // IsDynamicLength is set when the length of the vector is written before its elements
+	IsFixedLength     bool // IsFixedLength is set when the vector always has Length elements
 	Length            uint32
 	WriteLengthMethod string
+	LengthPrefixBits  uint8 // LengthPrefixBits is the width of a fixed length prefix, 0 for var-length prefixes
+	IsByteArray       bool  // IsByteArray is set when the field is a ByteArray, written as a vector of bytes
 
-	UseTypeManager bool
+	UseTypeManager    bool
+	TypeIDWriteMethod string // TypeIDWriteMethod writes the protocol id of the concrete type before a type manager value
 
 	UseBBW      bool // Use BooleanByteWrapper
-	BBWPosition uint
+	BBWPosition uint // BBWPosition is a bit index across the wrapper bytes, see BBWByte and BBWBit
+
+	PresenceFlag string // PresenceFlag is the name of the boolean field telling whether the field is written at all
+	Optional     bool   // Optional is set along with PresenceFlag, on every field of the block the flag guards
+
+	Order int // Order is the index of the field in the serialize method of its class, see Protocol.ResolveFields
+
+	Default *string `json:",omitempty"` // Default is the AS3 literal the field holds once constructed, from its declaration or its constructor, nil when there is none
+
+	TypeRef *Class `json:"-"` // TypeRef points to the protocol type of the field, set by Link
+	EnumRef *Enum  `json:"-"` // EnumRef points to the enumeration of the field, set by Link
 }
 
 // Version represents a Dofus 2 Protocol version
@@ -70,13 +127,106 @@ type Version struct {
 	Release  uint
 	Revision uint
 	Patch    uint
+
+	BuildType string // BuildType is the name of the BuildTypeEnum value, like RELEASE or BETA
+}
+
+// BuildOptions configures how a Protocol is built
+type BuildOptions struct {
+	// Strict makes the extraction fail when a serialize method writes values
+	// with instructions that are not recognized by any pattern, and the
+	// verification fail when a field is not read the way it is written
+	Strict bool
+
+	// SkipTypes and SkipEnums leave the types and the enumerations out of
+	// the protocol
+	SkipTypes bool
+	SkipEnums bool
+
+	// NamespaceFilter, when set, is called with the namespace of every class
+	// and only the classes for which it returns true are extracted
+	NamespaceFilter func(namespace string) bool
+
+	// Logger receives a trace of the extraction, nothing is logged when nil
+	Logger Logger
+
+	// AbcTagName, when set, is the name of the only DoABC tag to parse.
+	// Otherwise every tag is searched for the classes of the client, starting
+	// with frame1.
+	AbcTagName string
+
+	// TypeAliases renames the reduced types of the scalar fields, like int16
+	// to int32. Method and the write methods are left untouched so the wire
+	// format does not change, the generated serializers convert the values
+	// to the type of their method. The aliases should be scalar types of
+	// this package or the verification of the build fails.
+	TypeAliases map[string]string
 }
 
-type builder struct {
+// Builder extracts the protocol classes from a parsed DofusInvoker.swf. Its
+// methods are safe for concurrent use.
+type Builder struct {
 	abcFile *as3.AbcFile
+	opts    BuildOptions
+
+	// sourceHash is the SHA-256 of the file the swf was read from
+	sourceHash string
+
+	// others holds a builder for each other DoABC tag of the invoker, the
+	// classes of every tag are searched as one
+	others []*Builder
+
+	// disassembling a method writes its instructions in the shared abcFile,
+	// each method is disassembled only once and the result is cached
+	mu           sync.Mutex
+	disassembled map[uint32]*disassembly
+
+	// classTraits indexes the class traits of the scripts by qualified
+	// name, it is built by the first lookup
+	classTraitsOnce sync.Once
+	classTraits     map[string]bytecode.TraitsInfo
+}
+
+type disassembly struct {
+	once   sync.Once
+	method as3.Method
+	err    error
 }
 
-func parseSwf(r io.ReadSeeker) (*swf.Swf, error) {
+// ErrSwfLZMACompressed means that the swf file is LZMA compressed (ZWS), the
+// swf package only inflates zlib compressed files (CWS)
+var ErrSwfLZMACompressed = errors.New("LZMA compressed swf, decompress first")
+
+// ErrSwfInvalidSignature means that the file does not start with a swf
+// signature
+var ErrSwfInvalidSignature = errors.New("invalid swf signature")
+
+// checkSwfSignature reads the signature of the swf file and rewinds r.
+// Uncompressed (FWS) and zlib compressed (CWS) files, which is how the
+// invoker is shipped, are handled by swf.Parse.
+func checkSwfSignature(r io.ReadSeeker) error {
+	signature := make([]byte, 3)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return ErrSwfInvalidSignature
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	switch string(signature) {
+	case "FWS", "CWS":
+		return nil
+	case "ZWS":
+		return ErrSwfLZMACompressed
+	}
+	return ErrSwfInvalidSignature
+}
+
+// ParseSwf parses the DofusInvoker.swf read from r. Uncompressed and zlib
+// compressed files are supported.
+func ParseSwf(r io.ReadSeeker) (*swf.Swf, error) {
+	if err := checkSwfSignature(r); err != nil {
+		return nil, newError(err, "swf parsing failed")
+	}
 	s, err := swf.Parse(r)
 	if err != nil {
 		return nil, newError(err, "swf parsing failed")
@@ -84,95 +234,320 @@ func parseSwf(r io.ReadSeeker) (*swf.Swf, error) {
 	return &s, nil
 }
 
-func parseAbc(s *swf.Swf) (*as3.AbcFile, error) {
+// doABCTags returns the DoABC tags of s, the frame1 tag of the official
+// clients comes first. Only the tag with the given name is returned when name
+// is set.
+func doABCTags(s *swf.Swf, name string) []*swf.TagDoABC {
+	var tags []*swf.TagDoABC
 	for _, tag := range s.Tags {
 		if tag.Code() != swf.CodeTagDoABC {
 			continue
 		}
 		doAbc := tag.(*swf.TagDoABC)
-		if doAbc.Name != "frame1" {
+		if name != "" && doAbc.Name != name {
 			continue
 		}
+		if doAbc.Name == "frame1" {
+			tags = append([]*swf.TagDoABC{doAbc}, tags...)
+		} else {
+			tags = append(tags, doAbc)
+		}
+	}
+	return tags
+}
 
-		abc, err := bytecode.Parse(bytecode.NewReader(bytes.NewReader(doAbc.ABCData)))
-		if err != nil {
-			return nil, newError(err, "abc parsing failed")
+func linkAbc(doAbc *swf.TagDoABC) (*as3.AbcFile, error) {
+	abc, err := bytecode.Parse(bytecode.NewReader(bytes.NewReader(doAbc.ABCData)))
+	if err != nil {
+		return nil, newError(err, "abc parsing failed")
+	}
+
+	l, err := as3.Link(&abc)
+	if err != nil {
+		return nil, newError(err, "abc linking failed")
+	}
+	return &l, nil
+}
+
+// hasDofusClasses reports whether abc declares classes of the client
+func hasDofusClasses(abc *as3.AbcFile) bool {
+	for _, c := range abc.Classes {
+		if strings.HasPrefix(c.Namespace, dofusPrefix) {
+			return true
 		}
+	}
+	return false
+}
+
+// parseAbcs links the DoABC tags that hold classes of the client. Repacked
+// invokers do not always put them in the frame1 tag and some spread them
+// across several tags, every tag is searched unless a tag name is given.
+func parseAbcs(s *swf.Swf, name string) ([]*as3.AbcFile, error) {
+	tags := doABCTags(s, name)
+	if name != "" && len(tags) == 0 {
+		return nil, newError(nil, fmt.Sprintf("swf file does not contain %v tag", name))
+	}
 
-		l, err := as3.Link(&abc)
+	var abcs []*as3.AbcFile
+	for _, doAbc := range tags {
+		l, err := linkAbc(doAbc)
 		if err != nil {
-			return nil, newError(err, "abc linking failed")
+			return nil, err
 		}
-		return &l, nil
+		if hasDofusClasses(l) {
+			abcs = append(abcs, l)
+		}
+	}
+	if len(abcs) == 0 {
+		return nil, newError(nil, "swf file does not contain the protocol classes")
 	}
-	return nil, newError(nil, "swf file does not contain frame1 tag")
+	return abcs, nil
 }
 
-// Build reads the DofusInvoker.swf at the given path and build a list of
-// message and types
-func Build(path string) (*Protocol, error) {
-	file, err := os.Open(path)
+// ParseAbc links the DoABC tag of s that holds the classes of the client,
+// frame1 for the official clients. When the classes are spread across several
+// tags, only the first of them is returned.
+func ParseAbc(s *swf.Swf) (*as3.AbcFile, error) {
+	abcs, err := parseAbcs(s, "")
 	if err != nil {
 		return nil, err
 	}
+	return abcs[0], nil
+}
 
-	s, err := parseSwf(file)
+// NewBuilder reads the DofusInvoker.swf at the given path and returns a
+// Builder able to extract its classes
+func NewBuilder(path string, opts BuildOptions) (*Builder, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	a, err := parseAbc(s)
+	s, err := ParseSwf(bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
+	b, err := newBuilderFromSwf(s, opts)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	b.sourceHash = hex.EncodeToString(sum[:])
+	return b, nil
+}
 
-	b := builder{abcFile: a}
+func newBuilderFromSwf(s *swf.Swf, opts BuildOptions) (*Builder, error) {
+	abcs, err := parseAbcs(s, opts.AbcTagName)
+	if err != nil {
+		return nil, err
+	}
+	b := &Builder{abcFile: abcs[0], opts: opts}
+	for _, a := range abcs[1:] {
+		b.others = append(b.others, &Builder{abcFile: a, opts: opts})
+	}
+	return b, nil
+}
+
+// parts returns the builders of every DoABC tag, b comes first
+func (b *Builder) parts() []*Builder {
+	return append([]*Builder{b}, b.others...)
+}
+
+// owner returns the builder of the DoABC tag that declares class
+func (b *Builder) owner(class as3.Class) *Builder {
+	if len(b.others) == 0 {
+		return b
+	}
+	for _, part := range b.parts() {
+		for _, c := range part.abcFile.Classes {
+			if c.Name == class.Name && c.Namespace == class.Namespace {
+				return part
+			}
+		}
+	}
+	return b
+}
+
+// Build reads the DofusInvoker.swf at the given path and build a list of
+// message and types
+func Build(path string) (*Protocol, error) {
+	return BuildWithOptions(path, BuildOptions{})
+}
+
+// BuildWithOptions is like Build but allows to configure the extraction
+func BuildWithOptions(path string, opts BuildOptions) (*Protocol, error) {
+	b, err := NewBuilder(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return b.buildProtocol()
+}
+
+// BuildFromSwf is like Build but takes a DofusInvoker.swf that the caller
+// already parsed
+func BuildFromSwf(s *swf.Swf) (*Protocol, error) {
+	b, err := newBuilderFromSwf(s, BuildOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return b.buildProtocol()
+}
+
+// buildProtocol builds, verifies and links the protocol
+func (b *Builder) buildProtocol() (*Protocol, error) {
 	p, err := b.Build()
 	if err != nil {
 		return nil, newError(err, "protocol build failed")
 	}
 
-	if err = Verify(&p); err != nil {
+	if err = b.verifyProtocol(&p); err != nil {
 		return nil, newError(err, "verification error")
 	}
+	p.Link()
 	return &p, nil
 }
 
+// verifyProtocol verifies a protocol built by b. The field types are not
+// resolved for a filtered build, and the read methods that do not match
+// their write method are only logged unless the build is strict.
+func (b *Builder) verifyProtocol(p *Protocol) error {
+	if err := verify(p, !p.Filtered); err != nil {
+		return err
+	}
+	if err := verifyReadMethods(p); err != nil {
+		if b.opts.Strict {
+			return err
+		}
+		b.logf("%v", err)
+	}
+	return nil
+}
+
+// filtered tells whether the build options leave classes out of the protocol
+func (b *Builder) filtered() bool {
+	return b.opts.SkipTypes || b.opts.SkipEnums || b.opts.NamespaceFilter != nil
+}
+
+// ParsedInvoker is a DofusInvoker.swf that is parsed once and from which the
+// protocol can be built several times without parsing it again
+type ParsedInvoker struct {
+	b *Builder
+}
+
+// ParseInvoker reads and parses the DofusInvoker.swf at the given path
+func ParseInvoker(path string) (*ParsedInvoker, error) {
+	b, err := NewBuilder(path, BuildOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &ParsedInvoker{b}, nil
+}
+
+// Build builds the protocol like the Build function does. The disassembled
+// methods are kept between two calls.
+func (pi *ParsedInvoker) Build() (*Protocol, error) {
+	return pi.b.buildProtocol()
+}
+
+// BuildLenient is like Build but does not stop at the first class that fails
+// to be extracted or verified. These classes are left out of the protocol and
+// their errors are returned. The error is only set when the DofusInvoker.swf
+// itself can not be read.
+func BuildLenient(path string) (*Protocol, []error, error) {
+	b, err := NewBuilder(path, BuildOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, errs := b.build(true)
+	errs = append(errs, verifyLenient(&p)...)
+	p.Link()
+	return &p, errs, nil
+}
+
 const (
+	dofusPrefix   = "com.ankamagames.dofus"
 	messagePrefix = "com.ankamagames.dofus.network.messages."
 	typePrefix    = "com.ankamagames.dofus.network.types."
 	enumPrefix    = "com.ankamagames.dofus.network.enums"
 )
 
-func (b *builder) Build() (Protocol, error) {
+type classKind int
+
+const (
+	kindNone classKind = iota
+	kindMessage
+	kindType
+	kindEnum
+)
+
+// classKind returns the section of the protocol a class belongs to, or
+// kindNone if the class is not part of the protocol or is filtered out by
+// the build options
+func (b *Builder) classKind(class as3.Class) classKind {
+	if b.opts.NamespaceFilter != nil && !b.opts.NamespaceFilter(class.Namespace) {
+		return kindNone
+	}
+	switch {
+	case strings.HasPrefix(class.Namespace, messagePrefix):
+		return kindMessage
+	case strings.HasPrefix(class.Namespace, typePrefix) && !b.opts.SkipTypes:
+		return kindType
+	case strings.HasPrefix(class.Namespace, enumPrefix) && !b.opts.SkipEnums:
+		return kindEnum
+	}
+	return kindNone
+}
+
+// Build extracts every message, type and enumeration along with the version.
+// Messages and types are sorted by protocol id then by name, enumerations by
+// name.
+func (b *Builder) Build() (Protocol, error) {
+	p, errs := b.build(false)
+	if len(errs) > 0 {
+		return Protocol{}, errs[0]
+	}
+	return p, nil
+}
+
+// build extracts the protocol. Unless lenient is set, it stops at the first
+// error. Otherwise, the classes that fail are skipped and their errors
+// collected.
+func (b *Builder) build(lenient bool) (Protocol, []error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Stream only fails when the context is already done
+	results, _ := b.Stream(ctx)
+
 	var types []Class
 	var messages []Class
 	var enums []Enum
-	for _, class := range b.abcFile.Classes {
-		isMessage := strings.HasPrefix(class.Namespace, messagePrefix)
-		isType := strings.HasPrefix(class.Namespace, typePrefix)
-		if isType || isMessage {
-			c, err := b.ExtractClass(class)
-			if err != nil {
-				return Protocol{}, err
-			}
-			switch {
-			case isType:
-				types = append(types, c)
-			case isMessage:
-				messages = append(messages, c)
-			}
-		} else if strings.HasPrefix(class.Namespace, enumPrefix) {
-			e, err := b.ExtractEnum(class)
-			if err != nil {
-				return Protocol{}, err
+	var errs []error
+	for r := range results {
+		if r.Err != nil {
+			if !lenient {
+				return Protocol{}, []error{r.Err}
 			}
-			enums = append(enums, e)
+			errs = append(errs, r.Err)
+			continue
+		}
+		switch {
+		case r.IsEnum:
+			enums = append(enums, r.Enum)
+		case r.IsMessage:
+			messages = append(messages, r.Class)
+		default:
+			types = append(types, r.Class)
 		}
 	}
 	v, err := b.ExtractVersion()
 	if err != nil {
-		return Protocol{}, err
+		if !lenient {
+			return Protocol{}, []error{err}
+		}
+		errs = append(errs, err)
 	}
-	return Protocol{messages, types, enums, v}, nil
+	// the classes come in the order of the abc file, they are sorted so that
+	// two builds of the same invoker are equal
+	return Protocol{sortedClasses(messages), sortedClasses(types), sortedEnums(enums), v, b.sourceHash, b.filtered(), &protocolIndex{}}, errs
 }
@@ -1,8 +1,15 @@
 package d2protocolparser
 
 import (
+	"errors"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/kelvyne/as3"
+	"github.com/kelvyne/as3/bytecode"
+	"github.com/kelvyne/swf"
 )
 
 func BenchmarkBuild(b *testing.B) {
@@ -20,10 +27,36 @@ func TestBuild(t *testing.T) {
 		t.Errorf("expected nil, got %v", err)
 	}
 
-	expectedVersion := Version{2, 39, 0, 117122, 0}
+	expectedVersion := Version{2, 39, 0, 117122, 0, "RELEASE"}
 	if !reflect.DeepEqual(p.Version, expectedVersion) {
 		t.Errorf("expected %v, got %v", expectedVersion, p.Version)
 	}
+	if len(p.SourceHash) != 64 {
+		t.Errorf("expected a SHA-256 hex digest, got %v", p.SourceHash)
+	}
+}
+
+func TestBuild_Deterministic(t *testing.T) {
+	first, err := Build("./fixtures/DofusInvoker.swf")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	second, err := Build("./fixtures/DofusInvoker.swf")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	// the lookup indexes are not part of the content
+	first.index, second.index = nil, nil
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected two builds to be equal")
+	}
+
+	for i := 1; i < len(first.Messages); i++ {
+		prev, cur := first.Messages[i-1], first.Messages[i]
+		if prev.ProtocolID > cur.ProtocolID || (prev.ProtocolID == cur.ProtocolID && prev.Name > cur.Name) {
+			t.Errorf("expected %v to come before %v", cur.Name, prev.Name)
+		}
+	}
 }
 
 func TestBuild_NewVersion(t *testing.T) {
@@ -32,8 +65,194 @@ func TestBuild_NewVersion(t *testing.T) {
 		t.Errorf("expected nil, got %v", err)
 	}
 
-	expectedVersion := Version{2, 42, 0, 1027565, 0}
+	expectedVersion := Version{2, 42, 0, 1027565, 0, "RELEASE"}
+	if !reflect.DeepEqual(p.Version, expectedVersion) {
+		t.Errorf("expected %v, got %v", expectedVersion, p.Version)
+	}
+}
+
+func TestBuildFromSwf(t *testing.T) {
+	file, err := os.Open("./fixtures/DofusInvoker.swf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	s, err := swf.Parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := BuildFromSwf(&s)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expectedVersion := Version{2, 39, 0, 117122, 0, "RELEASE"}
 	if !reflect.DeepEqual(p.Version, expectedVersion) {
 		t.Errorf("expected %v, got %v", expectedVersion, p.Version)
 	}
+
+	if _, err = BuildFromSwf(&swf.Swf{}); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestBuildLenient(t *testing.T) {
+	p, errs, err := BuildLenient("./fixtures/DofusInvoker.swf")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	expectedVersion := Version{2, 39, 0, 117122, 0, "RELEASE"}
+	if !reflect.DeepEqual(p.Version, expectedVersion) {
+		t.Errorf("expected %v, got %v", expectedVersion, p.Version)
+	}
+
+	if _, _, err = BuildLenient("./fixtures/DoesNotExist.swf"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestBuildWithOptions_Filter(t *testing.T) {
+	p, err := BuildWithOptions("./fixtures/DofusInvoker.swf", BuildOptions{
+		SkipTypes: true,
+		SkipEnums: true,
+		NamespaceFilter: func(ns string) bool {
+			return strings.HasPrefix(ns, "com.ankamagames.dofus.network.messages.connection")
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(p.Types) != 0 || len(p.Enums) != 0 {
+		t.Errorf("expected no types nor enums, got %v types and %v enums", len(p.Types), len(p.Enums))
+	}
+	if len(p.Messages) == 0 {
+		t.Errorf("expected connection messages, got none")
+	}
+	for _, m := range p.Messages {
+		if !strings.HasPrefix(m.Namespace, "com.ankamagames.dofus.network.messages.connection") {
+			t.Errorf("expected only connection messages, got %v.%v", m.Namespace, m.Name)
+		}
+	}
+}
+
+func TestParseInvoker(t *testing.T) {
+	pi, err := ParseInvoker("./fixtures/DofusInvoker.swf")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	first, err := pi.Build()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	second, err := pi.Build()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if first.Fingerprint() != second.Fingerprint() || first.Version != second.Version {
+		t.Errorf("expected both builds to be the same")
+	}
+}
+
+func Test_doABCTags(t *testing.T) {
+	s := &swf.Swf{Tags: []swf.Tag{
+		&swf.TagDoABC{Name: "merged"},
+		&swf.TagDoABC{Name: "frame1"},
+		&swf.TagDoABC{Name: "frame2"},
+	}}
+	names := func(tags []*swf.TagDoABC) []string {
+		var got []string
+		for _, tag := range tags {
+			got = append(got, tag.Name)
+		}
+		return got
+	}
+	expected := []string{"frame1", "merged", "frame2"}
+	if got := names(doABCTags(s, "")); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	expected = []string{"merged"}
+	if got := names(doABCTags(s, "merged")); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := parseAbcs(s, "frame3"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestParseAbc_NoClasses(t *testing.T) {
+	if _, err := ParseAbc(&swf.Swf{}); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func Test_hasDofusClasses(t *testing.T) {
+	abc := &as3.AbcFile{Classes: []as3.Class{{Name: "Main", Namespace: ""}}}
+	if hasDofusClasses(abc) {
+		t.Errorf("expected false, got true")
+	}
+	abc.Classes = append(abc.Classes, as3.Class{Name: "HelloGameMessage", Namespace: "com.ankamagames.dofus.network.messages.game.approach"})
+	if !hasDofusClasses(abc) {
+		t.Errorf("expected true, got false")
+	}
+}
+
+func TestBuilder_build_SeveralTags(t *testing.T) {
+	part := func(classes ...as3.Class) *Builder {
+		return &Builder{abcFile: &as3.AbcFile{Source: &bytecode.AbcFile{}, Classes: classes}}
+	}
+	b := part(as3.Class{Name: "AlignmentSideEnum", Namespace: "com.ankamagames.dofus.network.enums"})
+	b.others = []*Builder{
+		part(as3.Class{Name: "Main"}),
+		part(as3.Class{Name: "AccessoryPreviewErrorEnum", Namespace: "com.ankamagames.dofus.network.enums"}),
+	}
+
+	p, errs := b.build(true)
+	if len(errs) != 1 || errs[0] != ErrExtractNoBuildInfos {
+		t.Errorf("expected %v, got %v", ErrExtractNoBuildInfos, errs)
+	}
+	var got []string
+	for _, e := range p.Enums {
+		got = append(got, e.Name)
+	}
+	expected := []string{"AccessoryPreviewErrorEnum", "AlignmentSideEnum"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if o := b.owner(as3.Class{Name: "AccessoryPreviewErrorEnum", Namespace: "com.ankamagames.dofus.network.enums"}); o != b.others[1] {
+		t.Errorf("expected the third tag to own AccessoryPreviewErrorEnum")
+	}
+}
+
+func Test_checkSwfSignature(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"uncompressed", "FWS\x0a", nil},
+		{"zlib", "CWS\x0a", nil},
+		{"lzma", "ZWS\x0d", ErrSwfLZMACompressed},
+		{"not a swf", "PK\x03\x04", ErrSwfInvalidSignature},
+		{"truncated", "F", ErrSwfInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader(tt.data)
+			if err := checkSwfSignature(r); err != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+			if tt.want == nil && r.Len() != len(tt.data) {
+				t.Errorf("expected the reader to be rewound, %v bytes left", r.Len())
+			}
+		})
+	}
+
+	if _, err := ParseSwf(strings.NewReader("ZWS\x0d")); !errors.Is(err, ErrSwfLZMACompressed) {
+		t.Errorf("expected %v, got %v", ErrSwfLZMACompressed, err)
+	}
 }
@@ -0,0 +1,107 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// cSharpTypesMap maps the reduced Go types to C# types
+var cSharpTypesMap = map[string]string{
+	"int8":    "sbyte",
+	"uint8":   "byte",
+	"int16":   "short",
+	"uint16":  "ushort",
+	"int32":   "int",
+	"uint32":  "uint",
+	"int64":   "long",
+	"uint64":  "ulong",
+	"float32": "float",
+	"float64": "double",
+	"string":  "string",
+	"bool":    "bool",
+}
+
+func cSharpType(f Field) string {
+	if f.IsByteArray {
+		return "byte[]"
+	}
+	t := f.Type
+	if f.EnumRef != nil {
+		t = f.EnumRef.Name
+	} else {
+		if m, ok := goTypesMap[t]; ok {
+			t = m
+		}
+		if m, ok := cSharpTypesMap[t]; ok {
+			t = m
+		}
+	}
+	for i := 0; i < f.Dimensions(); i++ {
+		t = "List<" + t + ">"
+	}
+	return t
+}
+
+func writeCSharpEnum(buf *bytes.Buffer, e Enum) {
+	underlying := "int"
+	if e.Underlying == "uint" {
+		underlying = "uint"
+	}
+	fmt.Fprintf(buf, "    public enum %v : %v\n    {\n", e.Name, underlying)
+	for _, v := range e.Values {
+		if e.Underlying == "uint" {
+			fmt.Fprintf(buf, "        %v = %v,\n", v.Name, uint32(v.Value))
+		} else {
+			fmt.Fprintf(buf, "        %v = %v,\n", v.Name, v.Value)
+		}
+	}
+	buf.WriteString("    }\n\n")
+}
+
+func writeCSharpClass(buf *bytes.Buffer, c Class) {
+	fmt.Fprintf(buf, "    public class %v", c.Name)
+	if c.Parent != "" {
+		fmt.Fprintf(buf, " : %v", c.Parent)
+	}
+	buf.WriteString("\n    {\n")
+	switch {
+	case c.Abstract:
+		// an abstract class has no protocol id
+	case c.Parent != "":
+		// the protocol id of the parent is hidden by the one of its child
+		fmt.Fprintf(buf, "        public new const ushort ProtocolId = %v;\n", c.ProtocolID)
+	default:
+		fmt.Fprintf(buf, "        public const ushort ProtocolId = %v;\n", c.ProtocolID)
+	}
+	for _, f := range c.Fields {
+		fmt.Fprintf(buf, "\n        public %v %v { get; set; }\n", cSharpType(f), goExportedName(f.Name))
+	}
+	buf.WriteString("    }\n\n")
+}
+
+// GenerateCSharp writes C# classes for every type and message of the protocol
+// and C# enums for every enumeration to w, in the namespace ns. The classes
+// only hold the fields, they do not serialize themselves.
+func GenerateCSharp(p *Protocol, ns string, w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by d2protocolparser. DO NOT EDIT.\n\n")
+	buf.WriteString("using System.Collections.Generic;\n\n")
+	fmt.Fprintf(&buf, "namespace %v\n{\n", ns)
+	for _, e := range p.Enums {
+		writeCSharpEnum(&buf, e)
+	}
+	for _, c := range p.Types {
+		writeCSharpClass(&buf, c)
+	}
+	for _, c := range p.Messages {
+		writeCSharpClass(&buf, c)
+	}
+	// no blank line before the closing brace of the namespace
+	if n := buf.Len(); n > 0 && bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) {
+		buf.Truncate(n - 1)
+	}
+	buf.WriteString("}\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,90 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCSharp(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{
+				Name:       "IdentificationSuccessWithLoginTokenMessage",
+				Parent:     "IdentificationSuccessMessage",
+				ProtocolID: 6209,
+				Fields: []Field{
+					{Name: "loginToken", Type: "string"},
+				},
+			},
+		},
+		Types: []Class{
+			{
+				Name:       "KrosmasterFigure",
+				ProtocolID: 397,
+				Fields: []Field{
+					{Name: "figure", Type: "uint16"},
+					{Name: "bound", Type: "bool"},
+					{Name: "look", Type: "EntityLook", IsVector: true},
+					{Name: "content", Type: "uint8", IsVector: true, IsByteArray: true},
+				},
+			},
+		},
+		Enums: []Enum{
+			{"AlignmentSideEnum", []EnumValue{{"ALIGNMENT_UNKNOWN", -2}, {"ALIGNMENT_NEUTRAL", 0}}, "int", false, "int8"},
+		},
+	}
+
+	expected := `// Code generated by d2protocolparser. DO NOT EDIT.
+
+using System.Collections.Generic;
+
+namespace Dofus.Protocol
+{
+    public enum AlignmentSideEnum : int
+    {
+        ALIGNMENT_UNKNOWN = -2,
+        ALIGNMENT_NEUTRAL = 0,
+    }
+
+    public class KrosmasterFigure
+    {
+        public const ushort ProtocolId = 397;
+
+        public ushort Figure { get; set; }
+
+        public bool Bound { get; set; }
+
+        public List<EntityLook> Look { get; set; }
+
+        public byte[] Content { get; set; }
+    }
+
+    public class IdentificationSuccessWithLoginTokenMessage : IdentificationSuccessMessage
+    {
+        public new const ushort ProtocolId = 6209;
+
+        public string LoginToken { get; set; }
+    }
+}
+`
+	var buf bytes.Buffer
+	if err := GenerateCSharp(p, "Dofus.Protocol", &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected %v, got %v", expected, buf.String())
+	}
+}
+
+func TestGenerateCSharp_Abstract(t *testing.T) {
+	p := &Protocol{Types: []Class{{Name: "AbstractSocialGroupInfos", Abstract: true}}}
+
+	var buf bytes.Buffer
+	if err := GenerateCSharp(p, "Protocol", &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if strings.Contains(buf.String(), "ProtocolId") {
+		t.Errorf("expected no protocol id, got %v", buf.String())
+	}
+}
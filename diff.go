@@ -0,0 +1,133 @@
+package d2protocolparser
+
+// ClassChange is a class that exists in both protocols with a different name,
+// parent or fields
+type ClassChange struct {
+	Old Class
+	New Class
+}
+
+// EnumChange is an enumeration that exists in both protocols with different
+// values
+type EnumChange struct {
+	Old Enum
+	New Enum
+}
+
+// ProtocolDiff lists the differences between two protocols. Messages and
+// types are matched by protocol id, abstract ones and enumerations by name.
+type ProtocolDiff struct {
+	AddedMessages   []Class
+	RemovedMessages []Class
+	ChangedMessages []ClassChange
+
+	AddedTypes   []Class
+	RemovedTypes []Class
+	ChangedTypes []ClassChange
+
+	AddedEnums   []Enum
+	RemovedEnums []Enum
+	ChangedEnums []EnumChange
+}
+
+// Empty reports whether both protocols are the same
+func (d ProtocolDiff) Empty() bool {
+	return len(d.AddedMessages) == 0 && len(d.RemovedMessages) == 0 && len(d.ChangedMessages) == 0 &&
+		len(d.AddedTypes) == 0 && len(d.RemovedTypes) == 0 && len(d.ChangedTypes) == 0 &&
+		len(d.AddedEnums) == 0 && len(d.RemovedEnums) == 0 && len(d.ChangedEnums) == 0
+}
+
+// Diff returns what changed from old to new. A class is changed when its name
+// or parent changed, or when its fields changed by name, type or wire order.
+func Diff(old, new *Protocol) ProtocolDiff {
+	var d ProtocolDiff
+	d.AddedMessages, d.RemovedMessages, d.ChangedMessages = diffClasses(old.Messages, new.Messages)
+	d.AddedTypes, d.RemovedTypes, d.ChangedTypes = diffClasses(old.Types, new.Types)
+	d.AddedEnums, d.RemovedEnums, d.ChangedEnums = diffEnums(old.Enums, new.Enums)
+	return d
+}
+
+// classKey identifies a class between two protocols, by protocol id or by
+// name for abstract classes which have no id
+type classKey struct {
+	id   uint16
+	name string
+}
+
+func keyOf(c Class) classKey {
+	if c.Abstract {
+		return classKey{name: c.Name}
+	}
+	return classKey{id: c.ProtocolID}
+}
+
+func diffClasses(old, new []Class) (added, removed []Class, changed []ClassChange) {
+	olds := make(map[classKey]Class, len(old))
+	for _, c := range old {
+		olds[keyOf(c)] = c
+	}
+	news := make(map[classKey]bool, len(new))
+	for _, c := range new {
+		news[keyOf(c)] = true
+		o, ok := olds[keyOf(c)]
+		if !ok {
+			added = append(added, c)
+		} else if !sameClass(o, c) {
+			changed = append(changed, ClassChange{o, c})
+		}
+	}
+	for _, c := range old {
+		if !news[keyOf(c)] {
+			removed = append(removed, c)
+		}
+	}
+	return
+}
+
+func sameClass(a, b Class) bool {
+	if a.Name != b.Name || a.Parent != b.Parent || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		fa, fb := a.Fields[i], b.Fields[i]
+		if fa.Name != fb.Name || fa.Type != fb.Type || fa.Dimensions() != fb.Dimensions() {
+			return false
+		}
+	}
+	return true
+}
+
+func diffEnums(old, new []Enum) (added, removed []Enum, changed []EnumChange) {
+	olds := make(map[string]Enum, len(old))
+	for _, e := range old {
+		olds[e.Name] = e
+	}
+	news := make(map[string]bool, len(new))
+	for _, e := range new {
+		news[e.Name] = true
+		o, ok := olds[e.Name]
+		if !ok {
+			added = append(added, e)
+		} else if !sameEnum(o, e) {
+			changed = append(changed, EnumChange{o, e})
+		}
+	}
+	for _, e := range old {
+		if !news[e.Name] {
+			removed = append(removed, e)
+		}
+	}
+	return
+}
+
+func sameEnum(a, b Enum) bool {
+	if len(a.Values) != len(b.Values) {
+		return false
+	}
+	for i := range a.Values {
+		if a.Values[i] != b.Values[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package d2protocolparser
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	old := goldenProtocol()
+	if d := Diff(old, goldenProtocol()); !d.Empty() {
+		t.Errorf("expected empty diff, got %+v", d)
+	}
+
+	new := goldenProtocol()
+	// BasicCharactersListMessage is removed
+	new.Messages = new.Messages[:2]
+	// IdentificationMessage fields are reordered
+	fields := new.Messages[0].Fields
+	fields[4], fields[5] = fields[5], fields[4]
+	new.Messages = append(new.Messages, Class{Name: "HelloGameMessage", ProtocolID: 101})
+	// KrosmasterFigure bound changes type
+	new.Types[1].Fields = append([]Field{}, new.Types[1].Fields...)
+	new.Types[1].Fields[3].Type = "uint8"
+	new.Enums = append(new.Enums, Enum{"AccessoryPreviewErrorEnum", []EnumValue{{"PREVIEW_ERROR", 0}}, "uint", false, "uint8"})
+
+	d := Diff(old, new)
+	if len(d.AddedMessages) != 1 || d.AddedMessages[0].Name != "HelloGameMessage" {
+		t.Errorf("expected HelloGameMessage to be added, got %v", d.AddedMessages)
+	}
+	if len(d.RemovedMessages) != 1 || d.RemovedMessages[0].Name != "BasicCharactersListMessage" {
+		t.Errorf("expected BasicCharactersListMessage to be removed, got %v", d.RemovedMessages)
+	}
+	if len(d.ChangedMessages) != 1 || d.ChangedMessages[0].New.Name != "IdentificationMessage" {
+		t.Errorf("expected IdentificationMessage to be changed, got %v", d.ChangedMessages)
+	}
+	if len(d.AddedTypes) != 0 || len(d.RemovedTypes) != 0 {
+		t.Errorf("expected no added nor removed types, got %v and %v", d.AddedTypes, d.RemovedTypes)
+	}
+	if len(d.ChangedTypes) != 1 || d.ChangedTypes[0].Old.Name != "KrosmasterFigure" {
+		t.Errorf("expected KrosmasterFigure to be changed, got %v", d.ChangedTypes)
+	}
+	if len(d.AddedEnums) != 1 || d.AddedEnums[0].Name != "AccessoryPreviewErrorEnum" {
+		t.Errorf("expected AccessoryPreviewErrorEnum to be added, got %v", d.AddedEnums)
+	}
+
+	new.Enums[0].Values = append([]EnumValue{}, new.Enums[0].Values[1:]...)
+	if d = Diff(old, new); len(d.ChangedEnums) != 1 || d.ChangedEnums[0].New.Name != "AlignmentSideEnum" {
+		t.Errorf("expected AlignmentSideEnum to be changed, got %v", d.ChangedEnums)
+	}
+}
+
+func TestDiff_Abstract(t *testing.T) {
+	old := &Protocol{Messages: []Class{
+		{Name: "AbstractGameActionMessage", Abstract: true},
+		{Name: "AbstractPartyMessage", Abstract: true},
+	}}
+	new := &Protocol{Messages: []Class{
+		{Name: "AbstractGameActionMessage", Abstract: true},
+		{Name: "AbstractPartyEventMessage", Abstract: true},
+	}}
+	d := Diff(old, new)
+	if len(d.AddedMessages) != 1 || d.AddedMessages[0].Name != "AbstractPartyEventMessage" {
+		t.Errorf("expected AbstractPartyEventMessage to be added, got %v", d.AddedMessages)
+	}
+	if len(d.RemovedMessages) != 1 || d.RemovedMessages[0].Name != "AbstractPartyMessage" {
+		t.Errorf("expected AbstractPartyMessage to be removed, got %v", d.RemovedMessages)
+	}
+}
@@ -0,0 +1,56 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeDOTClass writes the node of c, an edge to its parent and an edge to
+// every type its fields reference. Fields of the same type share one edge
+// labelled with their names.
+func writeDOTClass(buf *bytes.Buffer, c Class, shape string, enums map[string]bool) {
+	fmt.Fprintf(buf, "  %q [shape=%v];\n", c.Name, shape)
+	if c.Parent != "" {
+		fmt.Fprintf(buf, "  %q -> %q [style=dashed, arrowhead=empty];\n", c.Name, c.Parent)
+	}
+
+	var targets []string
+	labels := map[string][]string{}
+	for _, f := range c.Fields {
+		if isScalarType(f) || enums[f.Type] {
+			continue
+		}
+		if _, ok := labels[f.Type]; !ok {
+			targets = append(targets, f.Type)
+		}
+		labels[f.Type] = append(labels[f.Type], f.Name)
+	}
+	for _, t := range targets {
+		fmt.Fprintf(buf, "  %q -> %q [label=%q];\n", c.Name, t, strings.Join(labels[t], ", "))
+	}
+}
+
+// GenerateDOT writes a Graphviz graph of the protocol to w. Messages are
+// boxes and types are ellipses, a class points to its parent with a dashed
+// edge and to the types of its fields with a plain edge. Scalar and
+// enumeration fields are left out.
+func GenerateDOT(p *Protocol, w io.Writer) error {
+	enums := map[string]bool{}
+	for _, e := range p.Enums {
+		enums[e.Name] = true
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph protocol {\n")
+	for _, c := range p.Types {
+		writeDOTClass(&buf, c, "ellipse", enums)
+	}
+	for _, c := range p.Messages {
+		writeDOTClass(&buf, c, "box", enums)
+	}
+	buf.WriteString("}\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
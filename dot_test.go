@@ -0,0 +1,43 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateDOT(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "GameRolePlayShowActorMessage", Fields: []Field{
+				{Name: "informations", Type: "GameRolePlayActorInformations", UseTypeManager: true},
+			}},
+		},
+		Types: []Class{
+			{Name: "GameContextActorInformations", Fields: []Field{
+				{Name: "contextualId", Type: "float64"},
+				{Name: "look", Type: "EntityLook"},
+				{Name: "previousLooks", Type: "EntityLook", IsVector: true},
+				{Name: "side", Type: "AlignmentSideEnum"},
+			}},
+			{Name: "GameRolePlayActorInformations", Parent: "GameContextActorInformations"},
+		},
+		Enums: []Enum{{Name: "AlignmentSideEnum"}},
+	}
+
+	expected := `digraph protocol {
+  "GameContextActorInformations" [shape=ellipse];
+  "GameContextActorInformations" -> "EntityLook" [label="look, previousLooks"];
+  "GameRolePlayActorInformations" [shape=ellipse];
+  "GameRolePlayActorInformations" -> "GameContextActorInformations" [style=dashed, arrowhead=empty];
+  "GameRolePlayShowActorMessage" [shape=box];
+  "GameRolePlayShowActorMessage" -> "GameRolePlayActorInformations" [label="informations"];
+}
+`
+	var buf bytes.Buffer
+	if err := GenerateDOT(p, &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected %v, got %v", expected, buf.String())
+	}
+}
@@ -0,0 +1,79 @@
+package d2protocolparser
+
+import "math"
+
+// DuplicateValues groups the names of the values of e that share the same
+// value. Values that have a single name are left out, the names are in
+// declaration order.
+func (e *Enum) DuplicateValues() map[int32][]string {
+	names := map[int32][]string{}
+	for _, v := range e.Values {
+		names[v.Value] = append(names[v.Value], v.Name)
+	}
+	for v, n := range names {
+		if len(n) < 2 {
+			delete(names, v)
+		}
+	}
+	return names
+}
+
+// isFlagSet reports whether values looks like a set of bit flags: every non
+// zero value is a distinct power of two and they are not just the sequence
+// 1, 2 that a small sequential enumeration would also have.
+func isFlagSet(values []EnumValue) bool {
+	seen := map[int32]bool{}
+	var max int32
+	for _, v := range values {
+		if v.Value == 0 {
+			continue
+		}
+		if v.Value < 0 || v.Value&(v.Value-1) != 0 || seen[v.Value] {
+			return false
+		}
+		seen[v.Value] = true
+		if v.Value > max {
+			max = v.Value
+		}
+	}
+	return max > int32(len(seen))
+}
+
+// enumBaseType returns the smallest integer type holding every value. The
+// type is signed when the enumeration is declared as int, so
+// AlignmentSideEnum and its -2 is an int8. The values of uint enumerations
+// hold the bits of the uint.
+func enumBaseType(underlying string, values []EnumValue) string {
+	if underlying == "uint" {
+		var max uint32
+		for _, v := range values {
+			if uint32(v.Value) > max {
+				max = uint32(v.Value)
+			}
+		}
+		switch {
+		case max <= math.MaxUint8:
+			return "uint8"
+		case max <= math.MaxUint16:
+			return "uint16"
+		}
+		return "uint32"
+	}
+
+	var min, max int32
+	for _, v := range values {
+		if v.Value < min {
+			min = v.Value
+		}
+		if v.Value > max {
+			max = v.Value
+		}
+	}
+	switch {
+	case min >= math.MinInt8 && max <= math.MaxInt8:
+		return "int8"
+	case min >= math.MinInt16 && max <= math.MaxInt16:
+		return "int16"
+	}
+	return "int32"
+}
@@ -0,0 +1,91 @@
+package d2protocolparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnum_DuplicateValues(t *testing.T) {
+	e := Enum{"ChatActivableChannelsEnum", []EnumValue{
+		{"CHANNEL_GLOBAL", 0},
+		{"CHANNEL_TEAM", 1},
+		{"PSEUDO_CHANNEL_PRIVATE", 9},
+		{"CHANNEL_DEFAULT", 0},
+		{"CHANNEL_FIGHT", 1},
+		{"CHANNEL_ALL", 0},
+	}, "uint", false, "uint8"}
+	expected := map[int32][]string{
+		0: {"CHANNEL_GLOBAL", "CHANNEL_DEFAULT", "CHANNEL_ALL"},
+		1: {"CHANNEL_TEAM", "CHANNEL_FIGHT"},
+	}
+	if got := e.DuplicateValues(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	unique := Enum{"AccessoryPreviewErrorEnum", []EnumValue{{"PREVIEW_ERROR", 0}, {"PREVIEW_COOLDOWN", 1}}, "uint", false, "uint8"}
+	if got := unique.DuplicateValues(); len(got) != 0 {
+		t.Errorf("expected no duplicates, got %v", got)
+	}
+}
+
+func Test_isFlagSet(t *testing.T) {
+	values := func(v ...int32) []EnumValue {
+		var values []EnumValue
+		for _, i := range v {
+			values = append(values, EnumValue{"VALUE", i})
+		}
+		return values
+	}
+	tests := []struct {
+		name   string
+		values []EnumValue
+		want   bool
+	}{
+		{"flags", values(0, 1, 2, 4, 8), true},
+		{"flags without zero", values(1, 4, 16), true},
+		{"sequential", values(0, 1, 2, 3), false},
+		{"small sequential", values(0, 1, 2), false},
+		{"negative", values(-1, 1, 2, 4), false},
+		{"duplicate", values(1, 2, 4, 4), false},
+		{"empty", values(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFlagSet(tt.values); got != tt.want {
+				t.Errorf("isFlagSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_enumBaseType(t *testing.T) {
+	values := func(vs ...int32) []EnumValue {
+		var values []EnumValue
+		for _, v := range vs {
+			values = append(values, EnumValue{"VALUE", v})
+		}
+		return values
+	}
+	tests := []struct {
+		name       string
+		underlying string
+		values     []EnumValue
+		want       string
+	}{
+		{"empty", "int", nil, "int8"},
+		{"small unsigned", "uint", values(0, 1, 2), "uint8"},
+		{"small signed", "int", values(-2, -1, 0, 3), "int8"},
+		{"int without negative", "int", values(0, 200), "int16"},
+		{"unsigned short", "uint", values(0, 256), "uint16"},
+		{"unsigned int", "uint", values(1, 65536), "uint32"},
+		{"unsigned above int range", "uint", values(1, -1), "uint32"},
+		{"signed int", "int", values(-1, 40000), "int32"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enumBaseType(tt.underlying, tt.values); got != tt.want {
+				t.Errorf("enumBaseType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
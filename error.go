@@ -1,6 +1,11 @@
 package d2protocolparser
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/kelvyne/as3"
+	"github.com/kelvyne/as3/bytecode"
+)
 
 type protocolError struct {
 	err error
@@ -14,3 +19,65 @@ func newError(err error, msg string) error {
 func (e *protocolError) Error() string {
 	return fmt.Sprintf("d2protocolparser error: %v (%v)", e.msg, e.err)
 }
+
+func (e *protocolError) Unwrap() error {
+	return e.err
+}
+
+// ExtractError is returned when a class can not be extracted. It carries the
+// class and, when known, the field that caused the failure.
+type ExtractError struct {
+	Class     string
+	Field     string
+	Namespace string
+	Cause     error
+}
+
+func newExtractError(class as3.Class, field string, cause error) *ExtractError {
+	return &ExtractError{class.Name, field, class.Namespace, cause}
+}
+
+func (e *ExtractError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%v.%v: %v", e.Namespace, e.Class, e.Cause)
+	}
+	return fmt.Sprintf("%v.%v:%v : %v", e.Namespace, e.Class, e.Field, e.Cause)
+}
+
+// Unwrap returns the cause of the error
+func (e *ExtractError) Unwrap() error {
+	return e.Cause
+}
+
+// InstructionError is the cause of an ExtractError raised while matching the
+// instructions of a method. It locates the instruction the failing pattern
+// starts at.
+type InstructionError struct {
+	Method      string
+	Offset      int
+	Instruction string
+	Cause       error
+}
+
+func (e *InstructionError) Error() string {
+	return fmt.Sprintf("%v at offset %v (%v): %v", e.Method, e.Offset, e.Instruction, e.Cause)
+}
+
+// Unwrap returns the cause of the error
+func (e *InstructionError) Unwrap() error {
+	return e.Cause
+}
+
+// withInstruction adds the location of an instruction to err. The class and
+// the field of an ExtractError stay on the outside, the location becomes its
+// cause.
+func withInstruction(err error, method string, offset int, instr bytecode.Instr) error {
+	loc := &InstructionError{method, offset, instr.Model.Name, err}
+	if e, ok := err.(*ExtractError); ok {
+		wrapped := *e
+		loc.Cause = e.Cause
+		wrapped.Cause = loc
+		return &wrapped
+	}
+	return loc
+}
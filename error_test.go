@@ -0,0 +1,56 @@
+package d2protocolparser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kelvyne/as3"
+)
+
+func TestExtractError(t *testing.T) {
+	class := as3.Class{Name: "IdentificationMessage", Namespace: "com.ankamagames.dofus.network.messages.connection"}
+
+	err := error(newExtractError(class, "autoconnect", ErrExtractBBWNotBoolean))
+	if !errors.Is(err, ErrExtractBBWNotBoolean) {
+		t.Errorf("expected %v to wrap %v", err, ErrExtractBBWNotBoolean)
+	}
+
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) {
+		t.Fatalf("expected %v to be an ExtractError", err)
+	}
+	if extractErr.Class != "IdentificationMessage" || extractErr.Field != "autoconnect" {
+		t.Errorf("expected IdentificationMessage:autoconnect, got %v:%v", extractErr.Class, extractErr.Field)
+	}
+
+	err = newExtractError(class, "", unmatchedError{[]int{12, 40}})
+	if !errors.Is(err, ErrExtractUnmatchedInstructions) {
+		t.Errorf("expected %v to wrap %v", err, ErrExtractUnmatchedInstructions)
+	}
+}
+
+func Test_withInstruction(t *testing.T) {
+	class := as3.Class{Name: "IdentificationMessage", Namespace: "com.ankamagames.dofus.network.messages.connection"}
+	err := withInstruction(newExtractError(class, "autoconnect", ErrExtractBBWNotBoolean), "serializeAs_IdentificationMessage", 12, instr("getlex"))
+	if !errors.Is(err, ErrExtractBBWNotBoolean) {
+		t.Errorf("expected %v to wrap %v", err, ErrExtractBBWNotBoolean)
+	}
+
+	var extractErr *ExtractError
+	if !errors.As(err, &extractErr) || extractErr.Field != "autoconnect" {
+		t.Fatalf("expected %v to be an ExtractError of autoconnect", err)
+	}
+	var instrErr *InstructionError
+	if !errors.As(err, &instrErr) {
+		t.Fatalf("expected %v to be an InstructionError", err)
+	}
+	if instrErr.Method != "serializeAs_IdentificationMessage" || instrErr.Offset != 12 || instrErr.Instruction != "getlex" {
+		t.Errorf("expected serializeAs_IdentificationMessage at offset 12 (getlex), got %v", instrErr)
+	}
+
+	expected := "com.ankamagames.dofus.network.messages.connection.IdentificationMessage:autoconnect : " +
+		"serializeAs_IdentificationMessage at offset 12 (getlex): " + ErrExtractBBWNotBoolean.Error()
+	if err.Error() != expected {
+		t.Errorf("expected %v, got %v", expected, err.Error())
+	}
+}
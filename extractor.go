@@ -2,6 +2,8 @@ package d2protocolparser
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,7 +14,7 @@ import (
 )
 
 // ErrExtractNoProtocolID means that the protocolId trait could not be found
-// when extracting class
+// when extracting class, ExtractClass marks such classes as abstract
 var ErrExtractNoProtocolID = errors.New("no protocolId found")
 
 // ErrExtractProtocolIDNotConst means that the protocolId trait is not a const trait
@@ -21,36 +23,183 @@ var ErrExtractProtocolIDNotConst = errors.New("protocolId not a const trait")
 // ErrExtractProtocolIDNotInt means that the protocolId trait is not an integer
 var ErrExtractProtocolIDNotInt = errors.New("protocolId not an int trait")
 
+// ErrExtractUnknownVersionLayout means that the BuildInfos static initializer
+// does not match any known version layout
+var ErrExtractUnknownVersionLayout = errors.New("unknown version layout")
+
+// ErrExtractDuplicateEnumValue means that several values of an enumeration
+// share the same value, it is only an error in strict mode
+var ErrExtractDuplicateEnumValue = errors.New("duplicate enumeration value")
+
 // ErrExtractNoBuildInfos means that the class BuildInfos was not found
 var ErrExtractNoBuildInfos = errors.New("no BuildInfos found")
 
-func (b *builder) ExtractEnum(class as3.Class) (Enum, error) {
+// ErrExtractClassNotFound means that no class has the requested name
+var ErrExtractClassNotFound = errors.New("class not found")
+
+// ErrExtractNotProtocolClass means that the requested class is neither a
+// message nor a type
+var ErrExtractNotProtocolClass = errors.New("class is not a message or a type")
+
+// ErrExtractUnmatchedInstructions means that, in strict mode, a serialize
+// method writes values with instructions that no pattern recognizes
+var ErrExtractUnmatchedInstructions = errors.New("unmatched serialize instructions")
+
+// ErrExtractNoSerializeMethod means that the class has no serializeAs_ method
+var ErrExtractNoSerializeMethod = errors.New("serialize method not found")
+
+// ErrExtractEnumValueNotInt means that an enumeration value is not an integer,
+// such slots are only an error in strict mode
+var ErrExtractEnumValueNotInt = errors.New("enumeration value is not an int")
+
+// ErrExtractFieldNotFound means that the serialize method writes a property
+// that is not a field of the class
+var ErrExtractFieldNotFound = errors.New("field not found")
+
+// ErrExtractNotVector means that a vector write is done on a field that is
+// not a vector
+var ErrExtractNotVector = errors.New("vector write on non-vector field")
+
+// ErrExtractInvalidWriteMethod means that a field is written with a method
+// that is not a write method
+var ErrExtractInvalidWriteMethod = errors.New("invalid write method")
+
+// ErrExtractInvalidTypeIDWrite means that the type id of a field is not
+// written with writeShort or writeVarShort
+var ErrExtractInvalidTypeIDWrite = errors.New("invalid write method for getTypeId")
+
+// ErrExtractUnexpectedLength means that a vector length was found but the
+// last field is not a static vector
+var ErrExtractUnexpectedLength = errors.New("vector length found but no static vector")
+
+// ErrExtractBBWNotBoolean means that the BooleanByteWrapper is used on a
+// field that is not a boolean
+var ErrExtractBBWNotBoolean = errors.New("BooleanByteWrapper usage on non boolean field")
+
+type unmatchedError struct {
+	offsets []int
+}
+
+func (e unmatchedError) Error() string {
+	return fmt.Sprintf("%v at offsets %v", ErrExtractUnmatchedInstructions, e.offsets)
+}
+
+func (e unmatchedError) Unwrap() error {
+	return ErrExtractUnmatchedInstructions
+}
+
+// disassemble returns the method at the given index with its instructions.
+// Methods are disassembled once, later calls return the cached result.
+func (b *Builder) disassemble(index uint32) (as3.Method, error) {
+	b.mu.Lock()
+	if b.disassembled == nil {
+		b.disassembled = map[uint32]*disassembly{}
+	}
+	d, ok := b.disassembled[index]
+	if !ok {
+		d = &disassembly{}
+		b.disassembled[index] = d
+	}
+	b.mu.Unlock()
+
+	d.once.Do(func() {
+		d.method = b.abcFile.Methods[index]
+		d.err = d.method.BodyInfo.Disassemble()
+	})
+	return d.method, d.err
+}
+
+// ExtractEnum extracts the values of an enumeration class
+func (b *Builder) ExtractEnum(class as3.Class) (Enum, error) {
+	if o := b.owner(class); o != b {
+		return o.ExtractEnum(class)
+	}
 	var values []EnumValue
+	// an enumeration is unsigned only if all its values are declared as uint
+	underlying := "uint"
 	for _, trait := range class.ClassTraits.Slots {
-		if trait.Source.VKind != bytecode.SlotKindInt {
-			return Enum{}, fmt.Errorf("enumeration value %v of %v is not an uint", trait.Name, class.Name)
+		value, ok := b.enumValue(trait.Source)
+		if !ok {
+			// some enumerations hold helper constants along with their values
+			if b.opts.Strict {
+				return Enum{}, newExtractError(class, trait.Name, ErrExtractEnumValueNotInt)
+			}
+			b.logf("%v.%v: skipped enumeration slot that is not an int", class.Name, trait.Name)
+			continue
+		}
+		if trait.Source.VKind != bytecode.SlotKindUInt && b.abcFile.Source.ConstantPool.MultinameString(trait.Source.Typename) != "uint" {
+			underlying = "int"
+		}
+		values = append(values, EnumValue{trait.Name, value})
+	}
+
+	if len(values) == 0 {
+		underlying = "int"
+	}
+	e := Enum{class.Name, values, underlying, isFlagSet(values), enumBaseType(underlying, values)}
+	dups := e.DuplicateValues()
+	keys := make([]int, 0, len(dups))
+	for v := range dups {
+		keys = append(keys, int(v))
+	}
+	sort.Ints(keys)
+	for _, v := range keys {
+		names := dups[int32(v)]
+		if b.opts.Strict {
+			err := fmt.Errorf("%v (%v) : %w", strings.Join(names, ", "), v, ErrExtractDuplicateEnumValue)
+			return Enum{}, newExtractError(class, names[1], err)
+		}
+		b.logf("%v: %v share the value %v", class.Name, strings.Join(names, ", "), v)
+	}
+	return e, nil
+}
+
+// enumValue returns the value of an enumeration slot. Values of the uint
+// constant pool keep their bits, the generators print them back as uint32.
+// Doubles are accepted when they hold an int.
+func (b *Builder) enumValue(slot bytecode.TraitsInfo) (int32, bool) {
+	pool := b.abcFile.Source.ConstantPool
+	switch slot.VKind {
+	case bytecode.SlotKindInt:
+		return pool.Integers[slot.VIndex], true
+	case bytecode.SlotKindUInt:
+		return int32(pool.UIntegers[slot.VIndex]), true
+	case bytecode.SlotKindDouble:
+		d := pool.Doubles[slot.VIndex]
+		if d != math.Trunc(d) || d < math.MinInt32 || d > math.MaxInt32 {
+			return 0, false
 		}
-		name := trait.Name
-		value := b.abcFile.Source.ConstantPool.Integers[trait.Source.VIndex]
-		values = append(values, EnumValue{name, value})
+		return int32(d), true
 	}
-	return Enum{class.Name, values}, nil
+	return 0, false
 }
 
-func (b *builder) ExtractClass(class as3.Class) (Class, error) {
+// ExtractClass extracts the fields and the serialization informations of a
+// message or type class
+func (b *Builder) ExtractClass(class as3.Class) (Class, error) {
+	return b.extractClass(class, nil)
+}
+
+// extractClass is ExtractClass, the patterns matched in the serialize method
+// are recorded in trace when it is not nil
+func (b *Builder) extractClass(class as3.Class, trace *ClassTrace) (Class, error) {
+	if o := b.owner(class); o != b {
+		return o.extractClass(class, trace)
+	}
+	b.logf("extracting class %v.%v", class.Namespace, class.Name)
 	trait, found := findMethodWithPrefix(class, "serializeAs_")
 	if !found {
-		return Class{}, fmt.Errorf("serialize method not found in class %v", class.Name)
+		return Class{}, newExtractError(class, "", ErrExtractNoSerializeMethod)
 	}
 
-	m := b.abcFile.Methods[trait.Method]
-	if err := m.BodyInfo.Disassemble(); err != nil {
-		return Class{}, fmt.Errorf("failed to disassemble %v", class.Name)
+	m, err := b.disassemble(trait.Method)
+	if err != nil {
+		return Class{}, newExtractError(class, "", err)
 	}
 
-	fields, err := b.extractMessageFields(class)
+	fields, isContainer, err := b.extractMessageFields(class)
 	if err != nil {
-		return Class{}, fmt.Errorf("failed retrieve %v's fields", class.Name)
+		return Class{}, newExtractError(class, "", err)
 	}
 
 	fieldMap := map[string]*Field{}
@@ -58,61 +207,288 @@ func (b *builder) ExtractClass(class as3.Class) (Class, error) {
 		fieldMap[f.Name] = &fields[i]
 	}
 
-	if err = b.extractSerializeMethods(class, m, fieldMap); err != nil {
+	written, err := b.extractSerializeMethods(class, methodNameWithPrefix(class, "serializeAs_"), m.BodyInfo.Instructions, fieldMap, trace)
+	if err != nil {
 		return Class{}, err
 	}
+	if err = b.extractDeserializeMethods(class, fieldMap); err != nil {
+		return Class{}, newExtractError(class, "", err)
+	}
+	if err = b.extractDefaults(class, fieldMap); err != nil {
+		return Class{}, newExtractError(class, "", err)
+	}
 
 	for i := range fields {
 		reduceType(&fields[i])
 		reduceMethod(&fields[i])
+		reduceReadMethod(&fields[i])
+		reduceLengthPrefix(&fields[i])
+		b.aliasType(&fields[i])
+		if fields[i].WriteMethod != "" {
+			b.logf("%v.%v: resolved %v as %v (%v)", class.Name, fields[i].Name, fields[i].WriteMethod, fields[i].Method, fields[i].Type)
+		}
+		if hasSignednessMismatch(fields[i]) {
+			b.logf("%v.%v: %v field read with %v, kept as %v", class.Name, fields[i].Name, fields[i].RawType, fields[i].ReadMethod, fields[i].Type)
+		}
 	}
+	fields = sortFieldsByWireOrder(fields, written)
+	reduceBBWPositions(fields)
 
-	protocolID, err := b.extractProtocolID(class)
+	protocolID, abstract, err := b.extractClassID(class)
 	if err != nil {
-		return Class{}, err
+		return Class{}, newExtractError(class, "", err)
 	}
 
-	useHashFunc, err := b.extractUseHashFunc(class)
+	useHashFunc, hashFunc, err := b.extractHashFunc(class)
+	if err != nil {
+		return Class{}, newExtractError(class, "", err)
+	}
 
 	superName := class.SuperName
 	if superName == "Object" || superName == "NetworkMessage" {
 		superName = ""
 	}
-	return Class{class.Name, class.Namespace, superName, fields, protocolID, useHashFunc}, nil
+	var hashKey []byte
+	if useHashFunc {
+		if hashKey, err = b.extractHashKey("HASH_FUNCTION"); err != nil {
+			return Class{}, newExtractError(class, "", err)
+		}
+	}
+	metadata := b.extractMetadata(class)
+	return Class{class.Name, class.Namespace, superName, fields, protocolID, useHashFunc, hashFunc, hashKey, isContainer, abstract, metadata}, nil
+}
+
+// qualifiedName returns namespace.name, or name in the top level package
+func qualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// classTrait returns the class trait of the script that declares class
+func (b *Builder) classTrait(class as3.Class) (bytecode.TraitsInfo, bool) {
+	b.classTraitsOnce.Do(func() {
+		pool := b.abcFile.Source.ConstantPool
+		b.classTraits = map[string]bytecode.TraitsInfo{}
+		for _, script := range b.abcFile.Source.Scripts {
+			for _, trait := range script.Traits {
+				if trait.Kind != bytecode.TraitsInfoClass {
+					continue
+				}
+				multiname := pool.Multinames[trait.Name]
+				namespace := pool.Strings[pool.Namespaces[multiname.Namespace].Name]
+				b.classTraits[qualifiedName(namespace, pool.Strings[multiname.Name])] = trait
+			}
+		}
+	})
+	trait, ok := b.classTraits[qualifiedName(class.Namespace, class.Name)]
+	return trait, ok
+}
+
+// extractMetadata returns the metadata tags of class. They are set on the
+// class trait of the script that declares it.
+func (b *Builder) extractMetadata(class as3.Class) map[string][]string {
+	trait, ok := b.classTrait(class)
+	if !ok {
+		return nil
+	}
+	pool := b.abcFile.Source.ConstantPool
+	var metadata map[string][]string
+	for _, index := range trait.Metadata {
+		info := b.abcFile.Source.Metadatas[index]
+		var items []string
+		for _, item := range info.Items {
+			value := pool.Strings[item.Value]
+			if key := pool.Strings[item.Key]; key != "" {
+				value = key + "=" + value
+			}
+			items = append(items, value)
+		}
+		if metadata == nil {
+			metadata = map[string][]string{}
+		}
+		name := pool.Strings[info.Name]
+		metadata[name] = append(metadata[name], items...)
+	}
+	return metadata
+}
+
+func (b *Builder) findProtocolClass(name string) (as3.Class, error) {
+	for _, part := range b.parts() {
+		for _, class := range part.abcFile.Classes {
+			if class.Name != name {
+				continue
+			}
+			if !strings.HasPrefix(class.Namespace, messagePrefix) && !strings.HasPrefix(class.Namespace, typePrefix) {
+				return class, ErrExtractNotProtocolClass
+			}
+			return class, nil
+		}
+	}
+	return as3.Class{}, ErrExtractClassNotFound
+}
+
+// ExtractClassByName extracts the message or type class with the given name
+// without extracting the whole protocol
+func (b *Builder) ExtractClassByName(name string) (Class, error) {
+	class, err := b.findProtocolClass(name)
+	if err != nil {
+		return Class{}, &ExtractError{Class: name, Namespace: class.Namespace, Cause: err}
+	}
+	return b.ExtractClass(class)
 }
 
-func (b *builder) extractUseHashFunc(class as3.Class) (bool, error) {
-	getPackFunc := func(c as3.Class) (bool, as3.Method) {
+// ExtractDependencies extracts the parent and the field types of c that are
+// protocol types, without extracting the whole protocol
+func (b *Builder) ExtractDependencies(c Class) ([]Class, error) {
+	names := []string{c.Parent}
+	for _, f := range c.Fields {
+		names = append(names, f.Type)
+	}
+
+	var deps []Class
+	seen := map[string]bool{}
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		class, err := b.findProtocolClass(name)
+		if err != nil {
+			// scalar types and non protocol classes are not dependencies
+			continue
+		}
+		dep, err := b.ExtractClass(class)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// extractHashFunc reports whether the pack method of class hashes the
+// serialized message with HASH_FUNCTION, see hashFuncName for the name
+func (b *Builder) extractHashFunc(class as3.Class) (bool, string, error) {
+	getPackFunc := func(c as3.Class) (bool, uint32) {
 		for _, m := range c.InstanceTraits.Methods {
 			if m.Name == "pack" {
-				return true, b.abcFile.Methods[m.Source.Method]
+				return true, m.Source.Method
 			}
 		}
-		return false, as3.Method{}
+		return false, 0
 	}
-	f, m := getPackFunc(class)
+	f, index := getPackFunc(class)
 	if !f {
-		return false, nil
+		return false, "", nil
 	}
-	if err := m.BodyInfo.Disassemble(); err != nil {
-		return false, fmt.Errorf("could not disassemble pack method: %v", err)
+	m, err := b.disassemble(index)
+	if err != nil {
+		return false, "", fmt.Errorf("could not disassemble pack method: %v", err)
 	}
+	instrs, _ := filterInstrs(m.BodyInfo.Instructions)
+	used, name := b.hashFuncName(instrs)
+	return used, name, nil
+}
+
+// hashFuncName reports whether instrs reference HASH_FUNCTION and returns
+// the property that is read or called on it, like hash in
+// HASH_FUNCTION.hash(data). The name is empty when HASH_FUNCTION is only
+// compared or called itself, which is the case in the official clients.
+func (b *Builder) hashFuncName(instrs []bytecode.Instr) (bool, string) {
+	used := false
+	for i, instr := range instrs {
+		if instr.Model.Name != "getlex" {
+			continue
+		}
+		multiname := b.abcFile.Source.ConstantPool.Multinames[instr.Operands[0]]
+		if multiname.Kind != bytecode.MultinameKindQName || b.abcFile.Source.ConstantPool.Strings[multiname.Name] != "HASH_FUNCTION" {
+			continue
+		}
+		used = true
+		// skip the arguments pushed before the call
+		j := i + 1
+		for j < len(instrs) && isHashFuncArgument(instrs[j]) {
+			j++
+		}
+		if j == len(instrs) {
+			continue
+		}
+		switch instrs[j].Model.Name {
+		case "getproperty", "callproperty", "callpropvoid":
+			prop := b.abcFile.Source.ConstantPool.Multinames[instrs[j].Operands[0]]
+			if prop.Kind == bytecode.MultinameKindQName {
+				return true, b.abcFile.Source.ConstantPool.Strings[prop.Name]
+			}
+		}
+	}
+	return used, ""
+}
 
-	for _, instr := range m.BodyInfo.Instructions {
-		if instr.Model.Name == "getlex" {
-			multiname := b.abcFile.Source.ConstantPool.Multinames[instr.Operands[0]]
-			if multiname.Kind == bytecode.MultinameKindQName {
-				name := b.abcFile.Source.ConstantPool.Strings[multiname.Name]
-				if name == "HASH_FUNCTION" {
-					return true, nil
+// isHashFuncArgument reports whether instr pushes an argument of a call
+func isHashFuncArgument(instr bytecode.Instr) bool {
+	name := instr.Model.Name
+	return strings.HasPrefix(name, "getlocal") || strings.HasPrefix(name, "push") || isValueConversion(instr)
+}
+
+// extractHashKey returns the string held by the static slot with the given
+// name, searched in the classes of every DoABC tag. The value is either the
+// one of the slot trait or the string the static initializer of the class
+// assigns to it. In the official clients HASH_FUNCTION is a Function set at
+// runtime, there is no value to extract and nil is returned.
+func (b *Builder) extractHashKey(name string) ([]byte, error) {
+	for _, part := range b.parts() {
+		for _, class := range part.abcFile.Classes {
+			for _, t := range class.ClassTraits.Slots {
+				if t.Name != name {
+					continue
+				}
+				if t.Source.VKind == bytecode.SlotKindUtf8 {
+					return []byte(part.abcFile.Source.ConstantPool.Strings[t.Source.VIndex]), nil
+				}
+				m, err := part.disassemble(class.ClassInfo.CInit)
+				if err != nil {
+					return nil, fmt.Errorf("could not disassemble %v static initializer: %v", class.Name, err)
 				}
+				instrs, _ := filterInstrs(m.BodyInfo.Instructions)
+				if value, ok := part.staticString(instrs, name); ok {
+					return []byte(value), nil
+				}
+				return nil, nil
 			}
 		}
 	}
-	return false, nil
+	return nil, nil
+}
+
+// staticString returns the string that instrs assign to the static slot
+// name, like NAME = "value" in a static initializer
+func (b *Builder) staticString(instrs []bytecode.Instr, name string) (string, bool) {
+	pool := b.abcFile.Source.ConstantPool
+	for i := range instrs {
+		lined, _, ok := matchPattern(instrs[i:], []string{"findproperty|getlocal0", "pushstring", "coerce?", "initproperty|setproperty"})
+		if !ok || b.multinameString(lined[3].Operands[0]) != name {
+			continue
+		}
+		return pool.Strings[lined[1].Operands[0]], true
+	}
+	return "", false
 }
 
-func (b *builder) extractProtocolID(class as3.Class) (uint16, error) {
+// extractClassID returns the protocol id of class. A message or a type without
+// one is abstract, which is not an error: clients add base classes that are
+// never sent and they must not make the whole build fail.
+func (b *Builder) extractClassID(class as3.Class) (id uint16, abstract bool, err error) {
+	id, err = b.extractProtocolID(class)
+	if err == ErrExtractNoProtocolID {
+		b.logf("%v: no protocol id, marked as abstract", class.Name)
+		return 0, true, nil
+	}
+	return id, false, err
+}
+
+func (b *Builder) extractProtocolID(class as3.Class) (uint16, error) {
 	for _, t := range class.ClassTraits.Slots {
 		if t.Name == "protocolId" {
 			if t.Source.Kind != bytecode.TraitsInfoConst {
@@ -128,20 +504,23 @@ func (b *builder) extractProtocolID(class as3.Class) (uint16, error) {
 	return 0, ErrExtractNoProtocolID
 }
 
-func (b *builder) extractMessageFields(class as3.Class) (f []Field, err error) {
+// extractMessageFields returns the fields of class, a class whose content is
+// a byte array behind accessors is a container, see Class.IsContainer
+func (b *Builder) extractMessageFields(class as3.Class) (f []Field, isContainer bool, err error) {
 	createField := func(name string, typeId uint32) Field {
 		t := b.abcFile.Source.ConstantPool.MultinameString(typeId)
-		var isVector bool
-		if strings.HasPrefix(t, "Vector<") {
+		var depth int
+		for strings.HasPrefix(t, "Vector<") {
 			typename := b.abcFile.Source.ConstantPool.Multinames[typeId]
-			param := b.abcFile.Source.ConstantPool.MultinameString(typename.Params[0])
-			t = param
-			isVector = true
-		} else if t == "ByteArray" {
-			isVector = true
-			t = "uint"
+			typeId = typename.Params[0]
+			t = b.abcFile.Source.ConstantPool.MultinameString(typeId)
+			depth++
+		}
+		if depth == 0 && t == "ByteArray" {
+			// byte arrays are kept as vectors of bytes for compatibility
+			return Field{Name: name, Type: "uint", RawType: t, IsVector: true, VectorDepth: 1, IsByteArray: true}
 		}
-		return Field{Name: name, Type: t, IsVector: isVector}
+		return Field{Name: name, Type: t, RawType: t, IsVector: depth > 0, VectorDepth: depth}
 	}
 
 	for _, slot := range class.InstanceTraits.Slots {
@@ -153,15 +532,17 @@ func (b *builder) extractMessageFields(class as3.Class) (f []Field, err error) {
 		f = append(f, field)
 	}
 
-	// NetworkDataContainerMessage uses a pair of setter/getter to store content
-	// It seems to be useless and the only packet that does so we need to
-	// also check for pairs of getter/setter
+	// NetworkDataContainerMessage uses a pair of setter/getter to store its
+	// content, the raw bytes of other messages. It is the only packet that
+	// does so but we need to also check for pairs of getter/setter
 	type getSetter struct {
 		getter     bool
 		getterType uint32
 		setter     bool
 	}
 	getSetters := map[string]*getSetter{}
+	// keep track of the declaration order so the extraction is deterministic
+	var getSetterNames []string
 
 	for _, m := range class.InstanceTraits.Methods {
 		isGetter := m.Source.Kind == bytecode.TraitsInfoGetter
@@ -174,6 +555,7 @@ func (b *builder) extractMessageFields(class as3.Class) (f []Field, err error) {
 		if !ok {
 			v = &getSetter{}
 			getSetters[m.Name] = v
+			getSetterNames = append(getSetterNames, m.Name)
 		}
 		v.getter = v.getter || isGetter
 		v.setter = v.setter || isSetter
@@ -183,17 +565,19 @@ func (b *builder) extractMessageFields(class as3.Class) (f []Field, err error) {
 		}
 	}
 
-	for name, gs := range getSetters {
+	for _, name := range getSetterNames {
+		gs := getSetters[name]
 		if !(gs.getter && gs.setter) {
 			continue
 		}
 		field := createField(name, gs.getterType)
+		isContainer = isContainer || field.IsByteArray
 		f = append(f, field)
 	}
 	return
 }
 
-func handleSimpleProp(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+func handleSimpleProp(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	get := instrs[0]
 	call := instrs[1]
 	getMultiname := b.abcFile.Source.ConstantPool.Multinames[get.Operands[0]]
@@ -211,17 +595,20 @@ func handleSimpleProp(b *builder, class as3.Class, fields map[string]*Field, ins
 
 	field, ok := fields[prop]
 	if !ok {
-		return nil, fmt.Errorf("%v.%v.%v field not found", class.Namespace, class.Name, prop)
+		return nil, newExtractError(class, prop, ErrExtractFieldNotFound)
 	}
 
 	field.WriteMethod = writeMethod
 	return field, nil
 }
 
-func handleVecPropLength(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+// handleVecPropLength recognizes the length written before the elements of a
+// vector, with any write method: writeShort, writeVarShort, writeVarInt...
+// The length may be converted before being written.
+func handleVecPropLength(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	get := instrs[0]
 	getLen := instrs[1]
-	call := instrs[2]
+	call := instrs[3]
 
 	getMultiname := b.abcFile.Source.ConstantPool.Multinames[get.Operands[0]]
 	getLenMultiname := b.abcFile.Source.ConstantPool.Multinames[getLen.Operands[0]]
@@ -237,7 +624,7 @@ func handleVecPropLength(b *builder, class as3.Class, fields map[string]*Field,
 
 	field, ok := fields[prop]
 	if !ok || !field.IsVector {
-		return nil, fmt.Errorf("%v.%v: write length on non-vector %v", class.Namespace, class.Name, prop)
+		return nil, newExtractError(class, prop, ErrExtractNotVector)
 	}
 	writeMethod := b.abcFile.Source.ConstantPool.Strings[callMultiname.Name]
 
@@ -250,7 +637,7 @@ func handleVecPropLength(b *builder, class as3.Class, fields map[string]*Field,
 	return field, nil
 }
 
-func handleTypeManagerProp(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+func handleTypeManagerProp(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	get := instrs[0]
 	getType := instrs[1]
 	call := instrs[2]
@@ -270,19 +657,26 @@ func handleTypeManagerProp(b *builder, class as3.Class, fields map[string]*Field
 	prop := b.abcFile.Source.ConstantPool.Strings[getMultiname.Name]
 	field, ok := fields[prop]
 	if !ok {
-		return nil, fmt.Errorf("%v.%v: getTypeId on %v field", class.Namespace, class.Name, prop)
+		return nil, newExtractError(class, prop, ErrExtractFieldNotFound)
 	}
 
 	writeMethod := b.abcFile.Source.ConstantPool.Strings[callMultiname.Name]
-	if writeMethod != "writeShort" {
-		return nil, fmt.Errorf("%v.%v: invalid %v for getTypeId", class.Namespace, class.Name, writeMethod)
+	if !isTypeIDWriteMethod(writeMethod) {
+		return nil, newExtractError(class, prop, fmt.Errorf("%w: %v", ErrExtractInvalidTypeIDWrite, writeMethod))
 	}
 
 	field.UseTypeManager = true
+	field.TypeIDWriteMethod = writeMethod
 	return field, nil
 }
 
-func handleVecScalarProp(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+// isTypeIDWriteMethod reports whether the type ids may be written with
+// method, some versions of the client write them as var shorts
+func isTypeIDWriteMethod(method string) bool {
+	return method == "writeShort" || method == "writeVarShort"
+}
+
+func handleVecScalarProp(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	get := instrs[0]
 	getIndex := instrs[2]
 	getMultiname := b.abcFile.Source.ConstantPool.Multinames[get.Operands[0]]
@@ -299,19 +693,20 @@ func handleVecScalarProp(b *builder, class as3.Class, fields map[string]*Field,
 
 	writeMethod := b.abcFile.Source.ConstantPool.Strings[callMultiname.Name]
 	if !strings.HasPrefix(writeMethod, "write") {
-		return nil, fmt.Errorf("%v.%v: %v method for vector of scalar types", class.Namespace, class.Name, writeMethod)
+		prop := b.abcFile.Source.ConstantPool.Strings[getMultiname.Name]
+		return nil, newExtractError(class, prop, fmt.Errorf("%w: %v", ErrExtractInvalidWriteMethod, writeMethod))
 	}
 
 	prop := b.abcFile.Source.ConstantPool.Strings[getMultiname.Name]
 	field, ok := fields[prop]
 	if !ok || !field.IsVector {
-		return nil, fmt.Errorf("%v.%v: vector of scalar write on %v field", class.Namespace, class.Name, prop)
+		return nil, newExtractError(class, prop, ErrExtractNotVector)
 	}
 	field.WriteMethod = writeMethod
 	return field, nil
 }
 
-func handleVecTypeManagerProp(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+func handleVecTypeManagerProp(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	get := instrs[0]
 	lex := instrs[3]
 	call := instrs[5]
@@ -337,24 +732,39 @@ func handleVecTypeManagerProp(b *builder, class as3.Class, fields map[string]*Fi
 	prop := b.abcFile.Source.ConstantPool.Strings[getMultiname.Name]
 	f, ok := fields[prop]
 	if !ok || !f.IsVector {
-		return nil, fmt.Errorf("%v.%v: %v field is not a vector", class.Namespace, class.Name, prop)
+		return nil, newExtractError(class, prop, ErrExtractNotVector)
+	}
+
+	// the type id is written right after getTypeId returns it
+	if len(instrs) > 6 && instrs[6].Model.Name == "callpropvoid" {
+		writeMethod := b.multinameString(instrs[6].Operands[0])
+		if !isTypeIDWriteMethod(writeMethod) {
+			return nil, newExtractError(class, prop, fmt.Errorf("%w: %v", ErrExtractInvalidTypeIDWrite, writeMethod))
+		}
+		f.TypeIDWriteMethod = writeMethod
 	}
 
 	f.UseTypeManager = true
 	return f, nil
 }
 
-func handleVecPropDynamicLen(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+func handleVecPropFixedLen(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	push := instrs[5]
 	len := push.Operands[0]
-	if last == nil || !last.IsVector || last.IsDynamicLength {
-		return nil, errors.New("vector length found but no dynamic vector")
+	if last == nil {
+		return nil, newExtractError(class, "", ErrExtractUnexpectedLength)
+	}
+	// the length of a vector is either written before its elements or fixed
+	// by the loop bound, never both
+	if !last.IsVector || last.IsDynamicLength {
+		return nil, newExtractError(class, last.Name, ErrExtractUnexpectedLength)
 	}
 	last.Length = len
+	last.IsFixedLength = true
 	return last, nil
 }
 
-func handleGetProperty(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+func handleGetProperty(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	get := instrs[0]
 	multi := b.abcFile.Source.ConstantPool.Multinames[get.Operands[0]]
 	if !isPublicQName(b.abcFile, multi) {
@@ -368,7 +778,7 @@ func handleGetProperty(b *builder, class as3.Class, fields map[string]*Field, in
 	return field, nil
 }
 
-func handleBBWProp(b *builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
+func handleBBWProp(b *Builder, class as3.Class, fields map[string]*Field, instrs []bytecode.Instr, last *Field) (*Field, error) {
 	lex := instrs[0]
 	lexMultiname := b.abcFile.Source.ConstantPool.Multinames[lex.Operands[0]]
 	lexName := b.abcFile.Source.ConstantPool.Strings[lexMultiname.Name]
@@ -385,7 +795,7 @@ func handleBBWProp(b *builder, class as3.Class, fields map[string]*Field, instrs
 
 	field, ok := fields[prop]
 	if !ok || field.Type != "Boolean" {
-		return nil, fmt.Errorf("%v.%v: %v usage of BooleanByteWrapper on non boolean field", class.Namespace, class.Name, prop)
+		return nil, newExtractError(class, prop, ErrExtractBBWNotBoolean)
 	}
 
 	field.UseBBW = true
@@ -393,193 +803,643 @@ func handleBBWProp(b *builder, class as3.Class, fields map[string]*Field, instrs
 	return field, nil
 }
 
-func (b *builder) extractSerializeMethods(class as3.Class, m as3.Method, fields map[string]*Field) error {
-	checkPattern := func(instrs []bytecode.Instr, pattern []string) bool {
-		if len(pattern) > len(instrs) {
-			return false
+// aliasType replaces the reduced type of f with its alias, see
+// BuildOptions.TypeAliases
+func (b *Builder) aliasType(f *Field) {
+	if alias, ok := b.opts.TypeAliases[f.Type]; ok {
+		f.Type = alias
+	}
+}
+
+// sortFieldsByWireOrder returns fields ordered as they were first touched by
+// the serialize method. Fields that were never touched keep their declaration
+// order and are placed last, their Order follows the written fields.
+func sortFieldsByWireOrder(fields []Field, written []*Field) []Field {
+	if len(fields) == 0 {
+		return fields
+	}
+	sorted := make([]Field, 0, len(fields))
+	seen := map[string]bool{}
+	for _, f := range written {
+		sorted = append(sorted, *f)
+		seen[f.Name] = true
+	}
+	for _, f := range fields {
+		if !seen[f.Name] {
+			f.Order = len(sorted)
+			sorted = append(sorted, f)
 		}
-		for i, str := range pattern {
-			if !strings.HasPrefix(instrs[i].Model.Name, str) {
-				return false
+	}
+	return sorted
+}
+
+// matchPattern matches pattern against the start of instrs. Each element of
+// pattern is a prefix of the instruction name, alternatives are separated by
+// | like astypelate|coerce and a trailing ? makes the instruction optional.
+// It returns instrs with the matched instructions lined up with pattern, a
+// missing optional instruction being left zero so the handlers keep their
+// indexes, and the number of instructions consumed.
+func matchPattern(instrs []bytecode.Instr, pattern []string) ([]bytecode.Instr, int, bool) {
+	lined := make([]bytecode.Instr, 0, len(pattern))
+	n := 0
+	for _, elem := range pattern {
+		optional := strings.HasSuffix(elem, "?")
+		elem = strings.TrimSuffix(elem, "?")
+		matched := false
+		if n < len(instrs) {
+			for _, alt := range strings.Split(elem, "|") {
+				if strings.HasPrefix(instrs[n].Model.Name, alt) {
+					matched = true
+					break
+				}
 			}
 		}
-		return true
+		switch {
+		case matched:
+			lined = append(lined, instrs[n])
+			n++
+		case optional:
+			lined = append(lined, bytecode.Instr{})
+		default:
+			return nil, 0, false
+		}
 	}
+	return append(lined, instrs[n:]...), n, true
+}
+
+// isIgnoredInstr reports whether instr never takes part in a pattern. Debug
+// builds interleave debug instructions with the serialize methods and labels
+// or nops may appear anywhere.
+func isIgnoredInstr(instr bytecode.Instr) bool {
+	name := instr.Model.Name
+	return strings.HasPrefix(name, "debug") || name == "nop" || name == "label"
+}
+
+// filterInstrs returns instrs without the ignored instructions, along with
+// the offset of each remaining instruction in instrs
+func filterInstrs(instrs []bytecode.Instr) ([]bytecode.Instr, []int) {
+	filtered := make([]bytecode.Instr, 0, len(instrs))
+	offsets := make([]int, 0, len(instrs))
+	for i, instr := range instrs {
+		if !isIgnoredInstr(instr) {
+			filtered = append(filtered, instr)
+			offsets = append(offsets, i)
+		}
+	}
+	return filtered, offsets
+}
+
+// extractSerializeMethods fills the write informations of fields and returns
+// them in the order they are serialized. The errors of the patterns are
+// located in the method with an InstructionError. The matched patterns and
+// the skipped instructions are recorded in trace when it is not nil. The
+// ignored instructions are filtered out first, reported offsets are still the
+// ones of the method.
+func (b *Builder) extractSerializeMethods(class as3.Class, method string, instrs []bytecode.Instr, fields map[string]*Field, trace *ClassTrace) ([]*Field, error) {
+	positions := bytePositions(instrs)
+	instrs, offsets := filterInstrs(instrs)
 
 	type pattern struct {
-		Fn      func(*builder, as3.Class, map[string]*Field, []bytecode.Instr, *Field) (*Field, error)
+		Name    string
+		Fn      func(*Builder, as3.Class, map[string]*Field, []bytecode.Instr, *Field) (*Field, error)
 		Pattern []string
 	}
 
-	// These must be sorted by pattern length to be sure to not miss any pattern
+	// These must be sorted by pattern length to be sure to not miss any
+	// pattern, see matchPattern for the syntax
 	patterns := []pattern{
-		{handleVecPropDynamicLen, []string{"getlocal", "increment", "convert", "setlocal", "getlocal", "pushbyte", "iflt"}},
-		{handleVecTypeManagerProp, []string{"getproperty", "getlocal", "getproperty", "getlex", "astypelate", "callproperty"}},
-		{handleBBWProp, []string{"getlex", "getlocal", "pushbyte", "getlocal", "getproperty", "callproperty"}},
-		{handleVecScalarProp, []string{"getproperty", "getlocal", "getproperty", "callpropvoid"}},
-		{handleVecPropLength, []string{"getproperty", "getproperty", "callpropvoid"}},
-		{handleSimpleProp, []string{"getproperty", "callpropvoid"}},
-		{handleTypeManagerProp, []string{"getproperty", "callproperty", "callpropvoid"}},
-		{handleGetProperty, []string{"getproperty"}},
-	}
-
-	instrs := m.BodyInfo.Instructions
-	instrLen := len(m.BodyInfo.Instructions)
+		{"handleVecPropFixedLen", handleVecPropFixedLen, []string{"getlocal", "increment", "convert", "setlocal", "getlocal", "pushbyte", "iflt"}},
+		// newer compilers coerce the element instead of using astypelate
+		{"handleVecTypeManagerProp", handleVecTypeManagerProp, []string{"getproperty", "getlocal", "getproperty", "getlex", "astypelate|coerce", "callproperty"}},
+		{"handleBBWProp", handleBBWProp, []string{"getlex", "getlocal", "pushbyte", "getlocal", "getproperty", "callproperty"}},
+		{"handleVecScalarProp", handleVecScalarProp, []string{"getproperty", "getlocal", "getproperty", "callpropvoid"}},
+		{"handleVecPropLength", handleVecPropLength, []string{"getproperty", "getproperty", "convert|coerce?", "callpropvoid"}},
+		{"handleSimpleProp", handleSimpleProp, []string{"getproperty", "callpropvoid"}},
+		{"handleTypeManagerProp", handleTypeManagerProp, []string{"getproperty", "callproperty", "callpropvoid"}},
+		{"handleGetProperty", handleGetProperty, []string{"getproperty"}},
+	}
+
+	instrLen := len(instrs)
 	var last *Field
+	var written []*Field
+	var unmatched []int
+	touched := map[*Field]bool{}
+	runStart := -1
+	// guard is the boolean field tested by the last if, the fields written
+	// before guardEnd, the byte position of the branch target, are only
+	// present when it is set
+	var guard *Field
+	guardEnd := 0
 	for i := 0; i < instrLen; {
 		var f *Field
 		var err error
+		matched := false
+		start := i
 		for _, p := range patterns {
-			if checkPattern(instrs[i:], p.Pattern) {
-				f, err = p.Fn(b, class, fields, instrs[i:], last)
+			lined, n, ok := matchPattern(instrs[i:], p.Pattern)
+			if ok {
+				f, err = p.Fn(b, class, fields, lined, last)
 				if err != nil {
-					return err
+					return nil, withInstruction(err, method, offsets[i], instrs[i])
+				}
+				if f != nil {
+					b.logf("%v.%v: matched pattern %v at offset %v", class.Name, f.Name, strings.Join(p.Pattern, " "), offsets[i])
+				}
+				trace.match(p.Name, offsets[i], f)
+				// a handler that does not recognize its instructions leaves
+				// the writes among them unaccounted for
+				if f == nil && b.opts.Strict {
+					for j := i; j < i+n; j++ {
+						if b.isUnmatchedWrite(instrs, j) {
+							unmatched = append(unmatched, offsets[j])
+						}
+					}
+				}
+				if f != nil && !touched[f] {
+					touched[f] = true
+					f.Order = len(written)
+					written = append(written, f)
 				}
-				i += len(p.Pattern)
+				i += n
+				matched = true
 			}
 		}
+		if guard != nil && positions[offsets[start]] >= guardEnd {
+			guard = nil
+		}
+		if f != nil && guard != nil && f != guard {
+			f.PresenceFlag = guard.Name
+			f.Optional = true
+		}
+		// the flag is either packed in a BooleanByteWrapper or written with
+		// writeBoolean, the types are not reduced yet
+		if f != nil && (f.UseBBW || f.Type == "Boolean") && i < instrLen && isPresenceGuard(instrs[i]) {
+			guard = f
+			guardEnd = branchTarget(instrs[i], positions[offsets[i]])
+		}
+		if !matched && b.opts.Strict && b.isUnmatchedWrite(instrs, i) {
+			unmatched = append(unmatched, offsets[i])
+		}
+		if !matched && runStart < 0 {
+			runStart = i
+		} else if matched && runStart >= 0 {
+			b.logUnmatched(class, instrs[runStart:start], offsets[runStart], offsets[start-1])
+			trace.skip(instrs[runStart:start], offsets[runStart])
+			runStart = -1
+		}
 		if f == nil {
 			i++
 		} else {
 			last = f
 		}
 	}
-	return nil
+	if runStart >= 0 {
+		b.logUnmatched(class, instrs[runStart:], offsets[runStart], offsets[instrLen-1])
+		trace.skip(instrs[runStart:], offsets[runStart])
+	}
+	if len(unmatched) > 0 {
+		return nil, newExtractError(class, "", unmatchedError{unmatched})
+	}
+	return written, nil
 }
 
-func (b *builder) ExtractVersion() (Version, error) {
-	findBuildInfos := func() *as3.Class {
-		for _, c := range b.abcFile.Classes {
-			if c.Namespace == "com.ankamagames.dofus" && c.Name == "BuildInfos" {
-				return &c
-			}
+// logUnmatched logs a run of instructions of a serialize method that no
+// pattern recognized, between the given offsets
+func (b *Builder) logUnmatched(class as3.Class, instrs []bytecode.Instr, from, to int) {
+	if b.opts.Logger == nil || len(instrs) == 0 {
+		return
+	}
+	names := make([]string, len(instrs))
+	for i, instr := range instrs {
+		names[i] = instr.Model.Name
+	}
+	b.logf("%v: unmatched instructions at offsets %v-%v: %v", class.Name, from, to, strings.Join(names, " "))
+}
+
+// isPresenceGuard reports whether instr skips a block when the boolean value
+// on top of the stack is false, like if (flag) does. The iftrue of
+// if (!flag) guards a block written when the flag is not set, which
+// PresenceFlag can not express.
+func isPresenceGuard(instr bytecode.Instr) bool {
+	return instr.Model.Name == "iffalse"
+}
+
+// operandKinds gives the encoding of the operands of the instructions
+// whose operands are not all u30, see instrSize
+var operandKinds = map[string]string{
+	"pushbyte":       "u8",
+	"getscopeobject": "u8",
+	"debug":          "u8 u30 u8 u30",
+}
+
+// isBranch reports whether instr jumps to an s24 offset, relative to the end
+// of the instruction
+func isBranch(instr bytecode.Instr) bool {
+	name := instr.Model.Name
+	return name == "jump" || strings.HasPrefix(name, "if")
+}
+
+// u30Size returns the number of bytes of v encoded as a variable length u30
+func u30Size(v uint32) int {
+	n := 1
+	for v >= 0x80 && n < 5 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// instrSize returns the number of bytes of the encoded instr: the opcode
+// followed by its operands
+func instrSize(instr bytecode.Instr) int {
+	size := 1
+	switch {
+	case isBranch(instr):
+		return size + 3
+	case instr.Model.Name == "lookupswitch":
+		// default offset, case count and one offset per case
+		return size + 3 + u30Size(instr.Operands[1]) + 3*(len(instr.Operands)-2)
+	}
+	kinds := strings.Fields(operandKinds[instr.Model.Name])
+	for i, v := range instr.Operands {
+		if i < len(kinds) && kinds[i] == "u8" {
+			size++
+		} else {
+			size += u30Size(v)
 		}
-		return nil
 	}
+	return size
+}
+
+// bytePositions returns the byte position of every instruction of a method
+// body, and its size as the last element
+func bytePositions(instrs []bytecode.Instr) []int {
+	positions := make([]int, len(instrs)+1)
+	for i, instr := range instrs {
+		positions[i+1] = positions[i] + instrSize(instr)
+	}
+	return positions
+}
+
+// branchTarget returns the byte position a branch at the given position jumps
+// to, its s24 offset is sign extended from 24 bits
+func branchTarget(instr bytecode.Instr, position int) int {
+	offset := int32(instr.Operands[0]<<8) >> 8
+	return position + instrSize(instr) + int(offset)
+}
 
-	extractValue := func(i bytecode.Instr) (uint, error) {
-		if i.Model.Name == "pushbyte" {
-			return uint(i.Operands[0]), nil
-		} else if i.Model.Name == "pushint" {
-			v := b.abcFile.Source.ConstantPool.Integers[i.Operands[0]]
-			return uint(v), nil
+// isUnmatchedWrite reports whether instrs[i] is a call to a write method whose
+// value does not come from a local variable or a constant, which means that
+// it most likely writes a field with a pattern no handler knows about
+func (b *Builder) isUnmatchedWrite(instrs []bytecode.Instr, i int) bool {
+	name := instrs[i].Model.Name
+	if name != "callpropvoid" && name != "callproperty" {
+		return false
+	}
+	multiname := b.abcFile.Source.ConstantPool.Multinames[instrs[i].Operands[0]]
+	method := b.abcFile.Source.ConstantPool.Strings[multiname.Name]
+	if !strings.HasPrefix(method, "write") {
+		return false
+	}
+	if i > 0 {
+		prev := instrs[i-1].Model.Name
+		if strings.HasPrefix(prev, "getlocal") || strings.HasPrefix(prev, "push") {
+			return false
 		}
-		return 0, fmt.Errorf("%v instruction detected when extracting version", i.Model.Name)
 	}
+	return true
+}
 
-	extractFromString := func(x string) (uint, error) {
-		n, err := strconv.Atoi(x)
+// extractDeserializeMethods sets the read method of the fields from the
+// deserialize method of the class. Recent clients move the read of every field
+// to a private _fieldFunc helper, those helpers are scanned as well. Fields
+// whose read was not recognized keep the read method derived from their write
+// method.
+func (b *Builder) extractDeserializeMethods(class as3.Class, fields map[string]*Field) error {
+	for _, t := range class.InstanceTraits.Methods {
+		isHelper := strings.HasPrefix(t.Name, "_") && strings.HasSuffix(t.Name, "Func")
+		if !strings.HasPrefix(t.Name, "deserializeAs_") && !isHelper {
+			continue
+		}
+		m, err := b.disassemble(t.Source.Method)
 		if err != nil {
-			return 0, err
+			return err
 		}
-		return uint(n), nil
+		instrs, _ := filterInstrs(m.BodyInfo.Instructions)
+		b.extractReadMethods(class, instrs, fields)
 	}
+	return nil
+}
 
-	buildInfos := findBuildInfos()
-	if buildInfos == nil {
-		return Version{}, ErrExtractNoBuildInfos
+// extractReadMethods recognizes the reads of instrs. A scalar is read with
+// `this.field = input.readX()` and a vector element is read into a local
+// variable pushed right after with `this.field.push(_val)`.
+func (b *Builder) extractReadMethods(class as3.Class, instrs []bytecode.Instr, fields map[string]*Field) {
+	for i, instr := range instrs {
+		if instr.Model.Name != "callproperty" {
+			continue
+		}
+		method := b.multinameString(instr.Operands[0])
+		if !strings.HasPrefix(method, "read") {
+			continue
+		}
+		j := i + 1
+		for j < len(instrs) && isValueConversion(instrs[j]) {
+			j++
+		}
+		if j >= len(instrs) {
+			continue
+		}
+		var f *Field
+		switch name := instrs[j].Model.Name; {
+		case name == "setproperty" || name == "initproperty":
+			f = fields[b.multinameString(instrs[j].Operands[0])]
+			if f != nil && f.IsVector {
+				f = nil
+			}
+		case strings.HasPrefix(name, "setlocal"):
+			// the length of a vector is read into a local too, but it is not
+			// followed by a push into the field
+			for k := j + 1; k < len(instrs) && k <= j+3; k++ {
+				if instrs[k].Model.Name != "getproperty" {
+					continue
+				}
+				if v := fields[b.multinameString(instrs[k].Operands[0])]; v != nil && v.IsVector {
+					f = v
+				}
+				break
+			}
+		}
+		if f == nil {
+			continue
+		}
+		f.ReadMethod = method
+		b.logf("%v.%v: read with %v at offset %v", class.Name, f.Name, method, i)
 	}
+}
 
-	m := b.abcFile.Methods[buildInfos.ClassInfo.CInit]
-	if err := m.BodyInfo.Disassemble(); err != nil {
-		return Version{}, fmt.Errorf("could not disassemble BuildInfos: %v", err)
+// extractDefaults sets the default of the fields initialized with a literal.
+// The compiler stores the initializers of the declarations in the slot
+// traits, which are set before the constructor runs, so an assignment of the
+// constructor overrides them. Objects and vectors built with new have no
+// literal and are left without default.
+func (b *Builder) extractDefaults(class as3.Class, fields map[string]*Field) error {
+	m, err := b.disassemble(class.InstanceInfo.IInit)
+	if err != nil {
+		return err
 	}
+	instrs, _ := filterInstrs(m.BodyInfo.Instructions)
+	b.extractSlotDefaults(class, fields)
+	b.extractInitDefaults(class, instrs, fields)
+	return nil
+}
 
-	instrs := m.BodyInfo.Instructions
-
-	// New versions of Dofus uses a new way to format the Version.
-	// public static var VERSION:Version = new Version("2.42.0",BuildTypeEnum.RELEASE,1027565,0);
+// the kinds of the slot values that have no constant pool entry
+const (
+	slotKindFalse bytecode.SlotKind = 0x0a
+	slotKindTrue  bytecode.SlotKind = 0x0b
+	slotKindNull  bytecode.SlotKind = 0x0c
+)
 
-	// Version 2.46 adds Debug informations
-	var major, minor, release, revision, patch uint
-	var err error
-
-	fmt.Println(len(instrs))
-	fmt.Println(instrs)
-	if instrs[2].Model.Name == "debug" {
-		majMinRelInstr := instrs[5]
-		revInstr := instrs[8]
-		patchInstr := instrs[9]
-
-		strIdx := majMinRelInstr.Operands[0]
-		// string of format "MAJOR.MINOR.RELEASE"
-		majMinRel := strings.Split(b.abcFile.Source.ConstantPool.Strings[strIdx], ".")
-		major, err = extractFromString(majMinRel[0])
-		if err != nil {
-			return Version{}, err
-		}
-		minor, err = extractFromString(majMinRel[1])
-		if err != nil {
-			return Version{}, err
+// extractSlotDefaults sets the default of the fields whose slot trait holds
+// a value, like public var lang:String = "fr"
+func (b *Builder) extractSlotDefaults(class as3.Class, fields map[string]*Field) {
+	for _, slot := range class.InstanceTraits.Slots {
+		f, ok := fields[slot.Name]
+		if !ok {
+			continue
 		}
-		release, err = extractFromString(majMinRel[2])
-		if err != nil {
-			return Version{}, err
+		literal, ok := b.slotLiteral(slot.Source)
+		if !ok {
+			continue
 		}
-		revision, err = extractValue(revInstr)
-		if err != nil {
-			return Version{}, err
+		f.Default = &literal
+		b.logf("%v.%v: default value %v", class.Name, f.Name, literal)
+	}
+}
+
+// slotLiteral returns the AS3 literal of the value of a slot trait, there is
+// none when the slot is not initialized
+func (b *Builder) slotLiteral(slot bytecode.TraitsInfo) (string, bool) {
+	pool := b.abcFile.Source.ConstantPool
+	switch slot.VKind {
+	case bytecode.SlotKindInt:
+		return strconv.Itoa(int(pool.Integers[slot.VIndex])), true
+	case bytecode.SlotKindUInt:
+		return strconv.FormatUint(uint64(pool.UIntegers[slot.VIndex]), 10), true
+	case bytecode.SlotKindDouble:
+		return strconv.FormatFloat(pool.Doubles[slot.VIndex], 'g', -1, 64), true
+	case bytecode.SlotKindUtf8:
+		return strconv.Quote(pool.Strings[slot.VIndex]), true
+	case slotKindTrue:
+		return "true", true
+	case slotKindFalse:
+		return "false", true
+	case slotKindNull:
+		return "null", true
+	}
+	return "", false
+}
+
+// extractInitDefaults recognizes the this.field = literal assignments of
+// instrs, a later assignment of the same field overrides the former. A field
+// assigned anything else, like a new object, is left without default.
+func (b *Builder) extractInitDefaults(class as3.Class, instrs []bytecode.Instr, fields map[string]*Field) {
+	for i := 0; i < len(instrs); i++ {
+		lined, n, ok := matchPattern(instrs[i:], []string{"getlocal0", "push", "convert|coerce?", "initproperty|setproperty"})
+		if ok {
+			if f, ok := fields[b.multinameString(lined[3].Operands[0])]; ok {
+				if literal, ok := b.pushedLiteral(lined[1]); ok {
+					f.Default = &literal
+					b.logf("%v.%v: default value %v", class.Name, f.Name, literal)
+					i += n - 1
+					continue
+				}
+			}
 		}
-		patch, err = extractValue(patchInstr)
-		if err != nil {
-			return Version{}, err
+		if name := instrs[i].Model.Name; name == "initproperty" || name == "setproperty" {
+			if f, ok := fields[b.multinameString(instrs[i].Operands[0])]; ok {
+				f.Default = nil
+			}
 		}
-	} else if instrs[4].Model.Name == "pushstring" {
-		majMinRelInstr := instrs[4]
-		revInstr := instrs[7]
-		patchInstr := instrs[8]
+	}
+}
 
-		strIdx := majMinRelInstr.Operands[0]
-		// string of format "MAJOR.MINOR.RELEASE"
-		majMinRel := strings.Split(b.abcFile.Source.ConstantPool.Strings[strIdx], ".")
-		major, err = extractFromString(majMinRel[0])
-		if err != nil {
-			return Version{}, err
+// pushedLiteral returns the AS3 literal of the constant pushed by instr
+func (b *Builder) pushedLiteral(instr bytecode.Instr) (string, bool) {
+	pool := b.abcFile.Source.ConstantPool
+	switch instr.Model.Name {
+	case "pushbyte":
+		return strconv.Itoa(int(int8(instr.Operands[0]))), true
+	case "pushshort":
+		return strconv.Itoa(int(int16(instr.Operands[0]))), true
+	case "pushint":
+		return strconv.Itoa(int(pool.Integers[instr.Operands[0]])), true
+	case "pushuint":
+		return strconv.FormatUint(uint64(pool.UIntegers[instr.Operands[0]]), 10), true
+	case "pushdouble":
+		return strconv.FormatFloat(pool.Doubles[instr.Operands[0]], 'g', -1, 64), true
+	case "pushstring":
+		return strconv.Quote(pool.Strings[instr.Operands[0]]), true
+	case "pushtrue":
+		return "true", true
+	case "pushfalse":
+		return "false", true
+	case "pushnull":
+		return "null", true
+	case "pushnan":
+		return "NaN", true
+	}
+	return "", false
+}
+
+// multinameString returns the name of the multiname at index
+func (b *Builder) multinameString(index uint32) string {
+	multiname := b.abcFile.Source.ConstantPool.Multinames[index]
+	return b.abcFile.Source.ConstantPool.Strings[multiname.Name]
+}
+
+// isValueConversion reports whether instr only converts the value on top of
+// the stack
+func isValueConversion(instr bytecode.Instr) bool {
+	name := instr.Model.Name
+	return strings.HasPrefix(name, "convert") || strings.HasPrefix(name, "coerce")
+}
+
+// versionLayout recognizes one way the BuildInfos static initializer builds
+// the version. Layouts are tried in order, the first one that matches wins.
+type versionLayout struct {
+	Name  string
+	Match func(b *Builder, instrs []bytecode.Instr) (Version, bool)
+}
+
+var versionLayouts = []versionLayout{
+	// Version 2.46 adds debug informations before the constructor call
+	{"debug", func(b *Builder, instrs []bytecode.Instr) (Version, bool) {
+		if len(instrs) <= 9 || instrs[2].Model.Name != "debug" {
+			return Version{}, false
 		}
-		minor, err = extractFromString(majMinRel[1])
-		if err != nil {
-			return Version{}, err
+		return b.versionFromString(instrs[5], instrs[8], instrs[9])
+	}},
+	// public static var VERSION:Version = new Version("2.42.0",BuildTypeEnum.RELEASE,1027565,0);
+	{"string", func(b *Builder, instrs []bytecode.Instr) (Version, bool) {
+		if len(instrs) <= 8 {
+			return Version{}, false
 		}
-		release, err = extractFromString(majMinRel[2])
-		if err != nil {
-			return Version{}, err
+		return b.versionFromString(instrs[4], instrs[7], instrs[8])
+	}},
+	// every part of the version is pushed as an integer
+	{"integers", func(b *Builder, instrs []bytecode.Instr) (Version, bool) {
+		if len(instrs) <= 17 {
+			return Version{}, false
 		}
-		revision, err = extractValue(revInstr)
-		if err != nil {
-			return Version{}, err
+		var parts [5]uint
+		for i, instr := range []bytecode.Instr{instrs[4], instrs[5], instrs[6], instrs[14], instrs[17]} {
+			v, ok := b.pushedValue(instr)
+			if !ok {
+				return Version{}, false
+			}
+			parts[i] = v
 		}
-		patch, err = extractValue(patchInstr)
+		return Version{Major: parts[0], Minor: parts[1], Release: parts[2], Revision: parts[3], Patch: parts[4]}, true
+	}},
+}
+
+// pushedValue returns the integer pushed by a pushbyte or pushint instruction
+func (b *Builder) pushedValue(i bytecode.Instr) (uint, bool) {
+	switch i.Model.Name {
+	case "pushbyte", "pushshort":
+		return uint(i.Operands[0]), true
+	case "pushint":
+		return uint(b.abcFile.Source.ConstantPool.Integers[i.Operands[0]]), true
+	}
+	return 0, false
+}
+
+// versionFromString builds a version from a pushed "MAJOR.MINOR.RELEASE"
+// string followed by the pushed revision and patch
+func (b *Builder) versionFromString(str, rev, patch bytecode.Instr) (Version, bool) {
+	if str.Model.Name != "pushstring" {
+		return Version{}, false
+	}
+	majMinRel := strings.Split(b.abcFile.Source.ConstantPool.Strings[str.Operands[0]], ".")
+	if len(majMinRel) != 3 {
+		return Version{}, false
+	}
+	var parts [3]uint
+	for i, part := range majMinRel {
+		n, err := strconv.ParseUint(part, 10, 0)
 		if err != nil {
-			return Version{}, err
+			return Version{}, false
 		}
-	} else {
-		majInstr := instrs[4]
-		minInstr := instrs[5]
-		relInstr := instrs[6]
-		revInstr := instrs[14]
-		patchInstr := instrs[17]
+		parts[i] = uint(n)
+	}
+	revision, ok := b.pushedValue(rev)
+	if !ok {
+		return Version{}, false
+	}
+	p, ok := b.pushedValue(patch)
+	if !ok {
+		return Version{}, false
+	}
+	return Version{Major: parts[0], Minor: parts[1], Release: parts[2], Revision: revision, Patch: p}, true
+}
 
-		major, err = extractValue(majInstr)
-		if err != nil {
-			return Version{}, err
+// ExtractVersion extracts the protocol version from the BuildInfos class
+func (b *Builder) ExtractVersion() (Version, error) {
+	var buildInfos *as3.Class
+	for _, part := range b.parts() {
+		for _, c := range part.abcFile.Classes {
+			if c.Namespace == "com.ankamagames.dofus" && c.Name == "BuildInfos" {
+				buildInfos = &c
+				break
+			}
 		}
-		minor, err = extractValue(minInstr)
-		if err != nil {
-			return Version{}, err
+		if buildInfos != nil {
+			if part != b {
+				return part.ExtractVersion()
+			}
+			break
 		}
-		release, err = extractValue(relInstr)
-		if err != nil {
-			return Version{}, err
+	}
+	if buildInfos == nil {
+		return Version{}, ErrExtractNoBuildInfos
+	}
+
+	m, err := b.disassemble(buildInfos.ClassInfo.CInit)
+	if err != nil {
+		return Version{}, fmt.Errorf("could not disassemble BuildInfos: %v", err)
+	}
+	return b.extractVersion(m.BodyInfo.Instructions)
+}
+
+func (b *Builder) extractVersion(instrs []bytecode.Instr) (Version, error) {
+	for _, layout := range versionLayouts {
+		v, ok := layout.Match(b, instrs)
+		if !ok {
+			continue
 		}
-		revision, err = extractValue(revInstr)
-		if err != nil {
-			return Version{}, err
+		b.logf("BuildInfos: matched %v version layout", layout.Name)
+		v.BuildType = b.extractBuildType(instrs)
+		return v, nil
+	}
+	return Version{}, ErrExtractUnknownVersionLayout
+}
+
+// extractBuildType returns the BuildTypeEnum value referenced in the BuildInfos
+// static initializer, or an empty string when there is none
+func (b *Builder) extractBuildType(instrs []bytecode.Instr) string {
+	for i := 0; i+1 < len(instrs); i++ {
+		lex, get := instrs[i], instrs[i+1]
+		if lex.Model.Name != "getlex" || get.Model.Name != "getproperty" {
+			continue
 		}
-		patch, err = extractValue(patchInstr)
-		if err != nil {
-			return Version{}, err
+		lexMultiname := b.abcFile.Source.ConstantPool.Multinames[lex.Operands[0]]
+		if b.abcFile.Source.ConstantPool.Strings[lexMultiname.Name] != "BuildTypeEnum" {
+			continue
 		}
+		getMultiname := b.abcFile.Source.ConstantPool.Multinames[get.Operands[0]]
+		return b.abcFile.Source.ConstantPool.Strings[getMultiname.Name]
 	}
-
-	return Version{major, minor, release, revision, patch}, nil
+	return ""
 }
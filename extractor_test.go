@@ -1,12 +1,15 @@
 package d2protocolparser
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kelvyne/as3"
-	"github.com/kelvyne/swf"
+	"github.com/kelvyne/as3/bytecode"
 )
 
 func open(t *testing.T) *as3.AbcFile {
@@ -20,18 +23,18 @@ func open(t *testing.T) *as3.AbcFile {
 		}
 	}()
 
-	s, err := swf.Parse(f)
+	s, err := ParseSwf(f)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	abc, err := parseAbc(&s)
+	abc, err := ParseAbc(s)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	return abc
 }
 
-func Test_builder_ExtractClass(t *testing.T) {
+func Test_Builder_ExtractClass(t *testing.T) {
 	abc := open(t)
 	simple, _ := abc.GetClassByName("GameFightOptionStateUpdateMessage")
 	byteArray, _ := abc.GetClassByName("RawDataMessage")
@@ -64,13 +67,18 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.game.context.fight",
 				"",
 				[]Field{
-					Field{Name: "fightId", Type: "uint16", WriteMethod: "writeShort", Method: "UInt16"},
-					Field{Name: "teamId", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8"},
-					Field{Name: "option", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8"},
-					Field{Name: "state", Type: "bool", WriteMethod: "writeBoolean", Method: "Boolean"},
+					Field{Name: "fightId", Type: "uint16", RawType: "uint", WriteMethod: "writeShort", ReadMethod: "readShort", Method: "UInt16", Default: literal("0")},
+					Field{Name: "teamId", Type: "uint8", RawType: "uint", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "UInt8", Order: 1, Default: literal("2")},
+					Field{Name: "option", Type: "uint8", RawType: "uint", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "UInt8", Order: 2, Default: literal("3")},
+					Field{Name: "state", Type: "bool", RawType: "Boolean", WriteMethod: "writeBoolean", ReadMethod: "readBoolean", Method: "Boolean", Order: 3, Default: literal("false")},
 				},
 				5927,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -83,12 +91,17 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"",
 				[]Field{
 					Field{
-						Name: "content", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8",
-						IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarInt",
+						Name: "content", Type: "uint8", RawType: "ByteArray", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "UInt8",
+						IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeVarInt", IsByteArray: true,
 					},
 				},
 				6253,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -100,10 +113,15 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.connection",
 				"IdentificationSuccessMessage",
 				[]Field{
-					Field{Name: "loginToken", Type: "string", WriteMethod: "writeUTF", Method: "String"},
+					Field{Name: "loginToken", Type: "string", RawType: "String", WriteMethod: "writeUTF", ReadMethod: "readUTF", Method: "String", Default: literal(`""`)},
 				},
 				6209,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -115,10 +133,15 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.game.character.stats",
 				"",
 				[]Field{
-					Field{Name: "newLevel", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8"},
+					Field{Name: "newLevel", Type: "uint8", RawType: "uint", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "UInt8", Default: literal("0")},
 				},
 				5670,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -130,13 +153,18 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.types.web.krosmaster",
 				"",
 				[]Field{
-					Field{Name: "uid", Type: "string", WriteMethod: "writeUTF", Method: "String"},
-					Field{Name: "figure", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16"},
-					Field{Name: "pedestal", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16"},
-					Field{Name: "bound", Type: "bool", WriteMethod: "writeBoolean", Method: "Boolean"},
+					Field{Name: "uid", Type: "string", RawType: "String", WriteMethod: "writeUTF", ReadMethod: "readUTF", Method: "String", Default: literal(`""`)},
+					Field{Name: "figure", Type: "uint16", RawType: "uint", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort", Method: "VarUInt16", IsVarLength: true, Order: 1, Default: literal("0")},
+					Field{Name: "pedestal", Type: "uint16", RawType: "uint", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort", Method: "VarUInt16", IsVarLength: true, Order: 2, Default: literal("0")},
+					Field{Name: "bound", Type: "bool", RawType: "Boolean", WriteMethod: "writeBoolean", ReadMethod: "readBoolean", Method: "Boolean", Order: 3, Default: literal("false")},
 				},
 				397,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -148,18 +176,23 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.connection",
 				"",
 				[]Field{
-					Field{Name: "version", Type: "VersionExtended"},
-					Field{Name: "lang", Type: "string", WriteMethod: "writeUTF", Method: "String"},
-					Field{Name: "credentials", Type: "int8", WriteMethod: "writeByte", Method: "Int8", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarInt"},
-					Field{Name: "serverId", Type: "int16", WriteMethod: "writeShort", Method: "Int16"},
-					Field{Name: "autoconnect", Type: "bool", UseBBW: true, BBWPosition: 0},
-					Field{Name: "useCertificate", Type: "bool", UseBBW: true, BBWPosition: 1},
-					Field{Name: "useLoginToken", Type: "bool", UseBBW: true, BBWPosition: 2},
-					Field{Name: "sessionOptionalSalt", Type: "int64", WriteMethod: "writeVarLong", Method: "VarInt64"},
-					Field{Name: "failedAttempts", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort"},
+					Field{Name: "autoconnect", Type: "bool", RawType: "Boolean", UseBBW: true, BBWPosition: 0, Default: literal("false")},
+					Field{Name: "useCertificate", Type: "bool", RawType: "Boolean", UseBBW: true, BBWPosition: 1, Order: 1, Default: literal("false")},
+					Field{Name: "useLoginToken", Type: "bool", RawType: "Boolean", UseBBW: true, BBWPosition: 2, Order: 2, Default: literal("false")},
+					Field{Name: "version", Type: "VersionExtended", RawType: "VersionExtended", Order: 3},
+					Field{Name: "lang", Type: "string", RawType: "String", WriteMethod: "writeUTF", ReadMethod: "readUTF", Method: "String", Order: 4, Default: literal(`""`)},
+					Field{Name: "credentials", Type: "int8", RawType: "int", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "Int8", IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeVarInt", Order: 5},
+					Field{Name: "serverId", Type: "int16", RawType: "int", WriteMethod: "writeShort", ReadMethod: "readShort", Method: "Int16", Order: 6, Default: literal("0")},
+					Field{Name: "sessionOptionalSalt", Type: "int64", RawType: "Number", WriteMethod: "writeVarLong", ReadMethod: "readVarLong", Method: "VarInt64", IsVarLength: true, Order: 7, Default: literal("0")},
+					Field{Name: "failedAttempts", Type: "uint16", RawType: "uint", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort", Method: "VarUInt16", IsVarLength: true, IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeShort", LengthPrefixBits: 16, Order: 8},
 				},
 				4,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -171,10 +204,15 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.game.character.choice",
 				"",
 				[]Field{
-					Field{Name: "characters", Type: "CharacterBaseInformations", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort", UseTypeManager: true},
+					Field{Name: "characters", Type: "CharacterBaseInformations", RawType: "CharacterBaseInformations", IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeShort", LengthPrefixBits: 16, UseTypeManager: true, TypeIDWriteMethod: "writeShort"},
 				},
 				6475,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -186,12 +224,17 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.types.game.context",
 				"",
 				[]Field{
-					Field{Name: "contextualId", Type: "float64", WriteMethod: "writeDouble", Method: "Double"},
-					Field{Name: "look", Type: "EntityLook"},
-					Field{Name: "disposition", Type: "EntityDispositionInformations", UseTypeManager: true},
+					Field{Name: "contextualId", Type: "float64", RawType: "Number", WriteMethod: "writeDouble", ReadMethod: "readDouble", Method: "Double", Default: literal("0")},
+					Field{Name: "look", Type: "EntityLook", RawType: "EntityLook", Order: 1},
+					Field{Name: "disposition", Type: "EntityDispositionInformations", RawType: "EntityDispositionInformations", UseTypeManager: true, TypeIDWriteMethod: "writeShort", Order: 2},
 				},
 				150,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -203,10 +246,15 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.game.alliance",
 				"",
 				[]Field{
-					Field{Name: "targetId", Type: "int64", WriteMethod: "writeVarLong", Method: "VarInt64"},
+					Field{Name: "targetId", Type: "uint64", RawType: "Number", WriteMethod: "writeVarLong", ReadMethod: "readVarUhLong", Method: "VarUInt64", IsVarLength: true, Default: literal("0")},
 				},
 				6395,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -218,17 +266,22 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.types.game.context.roleplay",
 				"GameRolePlayActorInformations",
 				[]Field{
-					Field{Name: "staticInfos", Type: "GroupMonsterStaticInformations", UseTypeManager: true},
-					Field{Name: "creationTime", Type: "float64", WriteMethod: "writeDouble", Method: "Double"},
-					Field{Name: "ageBonusRate", Type: "uint32", WriteMethod: "writeInt", Method: "UInt32"},
-					Field{Name: "lootShare", Type: "int8", WriteMethod: "writeByte", Method: "Int8"},
-					Field{Name: "alignmentSide", Type: "int8", WriteMethod: "writeByte", Method: "Int8"},
-					Field{Name: "keyRingBonus", Type: "bool", UseBBW: true, BBWPosition: 0},
-					Field{Name: "hasHardcoreDrop", Type: "bool", UseBBW: true, BBWPosition: 1},
-					Field{Name: "hasAVARewardToken", Type: "bool", UseBBW: true, BBWPosition: 2},
+					Field{Name: "keyRingBonus", Type: "bool", RawType: "Boolean", UseBBW: true, BBWPosition: 0, Default: literal("false")},
+					Field{Name: "hasHardcoreDrop", Type: "bool", RawType: "Boolean", UseBBW: true, BBWPosition: 1, Order: 1, Default: literal("false")},
+					Field{Name: "hasAVARewardToken", Type: "bool", RawType: "Boolean", UseBBW: true, BBWPosition: 2, Order: 2, Default: literal("false")},
+					Field{Name: "staticInfos", Type: "GroupMonsterStaticInformations", RawType: "GroupMonsterStaticInformations", UseTypeManager: true, TypeIDWriteMethod: "writeShort", Order: 3},
+					Field{Name: "creationTime", Type: "float64", RawType: "Number", WriteMethod: "writeDouble", ReadMethod: "readDouble", Method: "Double", Order: 4, Default: literal("0")},
+					Field{Name: "ageBonusRate", Type: "uint32", RawType: "uint", WriteMethod: "writeInt", ReadMethod: "readInt", Method: "UInt32", Order: 5, Default: literal("0")},
+					Field{Name: "lootShare", Type: "int8", RawType: "int", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "Int8", Order: 6, Default: literal("0")},
+					Field{Name: "alignmentSide", Type: "int8", RawType: "int", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "Int8", Order: 7, Default: literal("0")},
 				},
 				160,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -241,12 +294,17 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"",
 				[]Field{
 					Field{
-						Name: "content", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8",
-						IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarInt",
+						Name: "content", Type: "uint8", RawType: "ByteArray", WriteMethod: "writeByte", ReadMethod: "readByte", Method: "UInt8",
+						IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeVarInt", IsByteArray: true,
 					},
 				},
 				2,
 				false,
+				"",
+				nil,
+				true,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -260,6 +318,11 @@ func Test_builder_ExtractClass(t *testing.T) {
 				nil,
 				101,
 				false,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
@@ -271,34 +334,128 @@ func Test_builder_ExtractClass(t *testing.T) {
 				"com.ankamagames.dofus.network.messages.game.basic",
 				"",
 				[]Field{
-					Field{Name: "latency", Type: "uint16", WriteMethod: "writeShort", Method: "UInt16"},
-					Field{Name: "sampleCount", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16"},
-					Field{Name: "max", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16"},
+					Field{Name: "latency", Type: "uint16", RawType: "uint", WriteMethod: "writeShort", ReadMethod: "readShort", Method: "UInt16", Default: literal("0")},
+					Field{Name: "sampleCount", Type: "uint16", RawType: "uint", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort", Method: "VarUInt16", IsVarLength: true, Order: 1, Default: literal("0")},
+					Field{Name: "max", Type: "uint16", RawType: "uint", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort", Method: "VarUInt16", IsVarLength: true, Order: 2, Default: literal("0")},
 				},
 				5663,
 				true,
+				"",
+				nil,
+				false,
+				false,
+				nil,
 			},
 			false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			b := &builder{
+			b := &Builder{
 				abcFile: abc,
 			}
 			got, err := b.ExtractClass(tt.args.class)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("builder.ExtractClass() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Builder.ExtractClass() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("builder.ExtractClass() = %v, want %v", got, tt.want)
+				t.Errorf("Builder.ExtractClass() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_builder_ExtractEnum(t *testing.T) {
+func Test_Builder_ExtractClass_Deterministic(t *testing.T) {
+	abc := open(t)
+	dataContainer, _ := abc.GetClassByName("NetworkDataContainerMessage")
+
+	b := &Builder{abcFile: abc}
+	first, err := b.ExtractClass(dataContainer)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := b.ExtractClass(dataContainer)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if !reflect.DeepEqual(got.Fields, first.Fields) {
+			t.Errorf("expected %v, got %v", first.Fields, got.Fields)
+		}
+	}
+}
+
+func Test_Builder_ExtractClass_BBWBytes(t *testing.T) {
+	b := &Builder{abcFile: open(t)}
+
+	// the 21 flags of ActorRestrictionsInformations span three bytes
+	c, err := b.ExtractClassByName("ActorRestrictionsInformations")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	names := []string{
+		"cantBeAggressed", "cantBeChallenged", "cantTrade", "cantBeAttackedByMutant", "cantRun", "forceSlowWalk", "cantMinimize", "cantMove",
+		"cantAggress", "cantChallenge", "cantExchange", "cantAttack", "cantChat", "cantBeMerchant", "cantUseObject", "cantUseTaxCollector",
+		"cantUseInteractive", "cantSpeakToNPC", "cantChangeZone", "cantAttackMonster", "cantWalk8Directions",
+	}
+	if len(c.Fields) != len(names) {
+		t.Fatalf("expected %v fields, got %v", len(names), len(c.Fields))
+	}
+	for i, f := range c.Fields {
+		if f.Name != names[i] || !f.UseBBW {
+			t.Errorf("expected flag %v, got %v (UseBBW %v)", names[i], f.Name, f.UseBBW)
+		}
+		if f.BBWByte() != uint(i/8) || f.BBWBit() != uint(i%8) {
+			t.Errorf("expected %v at byte %v bit %v, got byte %v bit %v", f.Name, i/8, i%8, f.BBWByte(), f.BBWBit())
+		}
+	}
+}
+
+func Test_Builder_ExtractClass_Float(t *testing.T) {
+	b := &Builder{abcFile: open(t)}
+
+	// bonusMin and bonusMax are Number fields written with writeFloat
+	c, err := b.ExtractClassByName("DecraftedItemStackInfo")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	found := 0
+	for _, f := range c.Fields {
+		if f.Name != "bonusMin" && f.Name != "bonusMax" {
+			continue
+		}
+		found++
+		if f.Type != "float32" || f.RawType != "Number" || f.WriteMethod != "writeFloat" || f.Method != "Float" {
+			t.Errorf("expected %v to be a float32 written with writeFloat, got %v (%v) written with %v (%v)", f.Name, f.Type, f.RawType, f.WriteMethod, f.Method)
+		}
+	}
+	if found != 2 {
+		t.Errorf("expected bonusMin and bonusMax, got %v", c.Fields)
+	}
+}
+
+func Test_Builder_ExtractClassByName(t *testing.T) {
+	abc := open(t)
+	b := &Builder{abcFile: abc}
+
+	c, err := b.ExtractClassByName("CharacterLevelUpMessage")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if c.Name != "CharacterLevelUpMessage" || c.ProtocolID != 5670 {
+		t.Errorf("expected CharacterLevelUpMessage (5670), got %v (%v)", c.Name, c.ProtocolID)
+	}
+
+	if _, err = b.ExtractClassByName("AlignmentSideEnum"); err == nil {
+		t.Errorf("expected error for enumeration class, got nil")
+	}
+	if _, err = b.ExtractClassByName("DoesNotExistMessage"); err == nil {
+		t.Errorf("expected error for unknown class, got nil")
+	}
+}
+
+func Test_Builder_ExtractEnum(t *testing.T) {
 	abc := open(t)
 	simple, _ := abc.GetClassByName("AccessoryPreviewErrorEnum")
 	negative, _ := abc.GetClassByName("AlignmentSideEnum")
@@ -325,6 +482,9 @@ func Test_builder_ExtractEnum(t *testing.T) {
 					{"PREVIEW_COOLDOWN", 1},
 					{"PREVIEW_BAD_ITEM", 2},
 				},
+				"uint",
+				false,
+				"uint8",
 			},
 			false,
 		},
@@ -341,22 +501,818 @@ func Test_builder_ExtractEnum(t *testing.T) {
 					{"ALIGNMENT_EVIL", 2},
 					{"ALIGNMENT_MERCENARY", 3},
 				},
+				"int",
+				false,
+				"int8",
 			},
 			false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			b := &builder{
+			b := &Builder{
 				abcFile: abc,
 			}
 			got, err := b.ExtractEnum(tt.args.class)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("builder.ExtractEnum() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Builder.ExtractEnum() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("builder.ExtractEnum() = %v, want %v", got, tt.want)
+				t.Errorf("Builder.ExtractEnum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Builder_disassemble(t *testing.T) {
+	abc := open(t)
+	class, _ := abc.GetClassByName("GameFightOptionStateUpdateMessage")
+	trait, _ := findMethodWithPrefix(class, "serializeAs_")
+
+	b := &Builder{abcFile: abc}
+	first, err := b.disassemble(trait.Method)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	second, err := b.disassemble(trait.Method)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(b.disassembled) != 1 {
+		t.Errorf("expected 1 cached method, got %v", len(b.disassembled))
+	}
+	if !reflect.DeepEqual(first.BodyInfo.Instructions, second.BodyInfo.Instructions) {
+		t.Errorf("expected cached instructions to be equal")
+	}
+}
+
+type recordLogger []string
+
+func (l *recordLogger) Printf(format string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func Test_Builder_ExtractClass_Logger(t *testing.T) {
+	abc := open(t)
+	simple, _ := abc.GetClassByName("CharacterLevelUpMessage")
+
+	var l recordLogger
+	b := &Builder{abcFile: abc, opts: BuildOptions{Logger: &l}}
+	if _, err := b.ExtractClass(simple); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	expected := "extracting class com.ankamagames.dofus.network.messages.game.character.stats.CharacterLevelUpMessage"
+	if len(l) == 0 || l[0] != expected {
+		t.Fatalf("expected %v first, got %v", expected, l)
+	}
+	expected = "CharacterLevelUpMessage.newLevel: resolved writeByte as UInt8 (uint8)"
+	if l[len(l)-1] != expected {
+		t.Errorf("expected %v last, got %v", expected, l)
+	}
+
+	prefix := "CharacterLevelUpMessage: unmatched instructions at offsets 0-"
+	if len(l) < 2 || !strings.HasPrefix(l[1], prefix) {
+		t.Errorf("expected %v second, got %v", prefix, l)
+	}
+}
+
+func Test_Builder_extractVersion(t *testing.T) {
+	b := newTestBuilder("2.42.0", "2.46.0", "2.42")
+	b.abcFile.Source.ConstantPool.Integers = []int32{0, 117122, 1027565}
+	head := []bytecode.Instr{instr("getlocal0"), instr("pushscope")}
+
+	tests := []struct {
+		name    string
+		instrs  []bytecode.Instr
+		want    Version
+		wantErr error
+	}{
+		{
+			"integers",
+			append(head,
+				instr("findpropstrict", 0), instr("getlex", 0),
+				instr("pushbyte", 2), instr("pushbyte", 39), instr("pushbyte", 0),
+				instr("construct", 3), instr("dup"), instr("pushbyte", 0), instr("setproperty", 0),
+				instr("dup"), instr("pushbyte", 0), instr("setproperty", 0),
+				instr("pushint", 1), instr("setproperty", 0), instr("dup"), instr("pushbyte", 0),
+			),
+			Version{Major: 2, Minor: 39, Release: 0, Revision: 117122},
+			nil,
+		},
+		{
+			"string",
+			append(head,
+				instr("findpropstrict", 0), instr("getlex", 0), instr("pushstring", 1),
+				instr("getlex", 0), instr("getproperty", 0), instr("pushint", 2), instr("pushbyte", 0),
+			),
+			Version{Major: 2, Minor: 42, Release: 0, Revision: 1027565},
+			nil,
+		},
+		{
+			"debug",
+			append(head,
+				instr("debug", 0), instr("findpropstrict", 0), instr("getlex", 0), instr("pushstring", 2),
+				instr("getlex", 0), instr("getproperty", 0), instr("pushint", 2), instr("pushbyte", 1),
+			),
+			Version{Major: 2, Minor: 46, Release: 0, Revision: 1027565, Patch: 1},
+			nil,
+		},
+		{
+			"unknown",
+			append(head,
+				instr("findpropstrict", 0), instr("getlex", 0), instr("pushstring", 3),
+				instr("getlex", 0), instr("getproperty", 0), instr("pushint", 2), instr("pushbyte", 0),
+			),
+			Version{},
+			ErrExtractUnknownVersionLayout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instrs := append([]bytecode.Instr{}, tt.instrs...)
+			got, err := b.extractVersion(instrs)
+			if err != tt.wantErr {
+				t.Fatalf("Builder.extractVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Builder.extractVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Builder_aliasType(t *testing.T) {
+	b := &Builder{opts: BuildOptions{TypeAliases: map[string]string{"int16": "int32", "uint16": "int32"}}}
+	tests := []struct {
+		name  string
+		field Field
+		want  Field
+	}{
+		{"alias", Field{Type: "uint16", Method: "VarUInt16"}, Field{Type: "int32", Method: "VarUInt16"}},
+		{"no alias", Field{Type: "int8", Method: "Int8"}, Field{Type: "int8", Method: "Int8"}},
+		{"type", Field{Type: "EntityLook"}, Field{Type: "EntityLook"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.aliasType(&tt.field)
+			if !reflect.DeepEqual(tt.field, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, tt.field)
+			}
+		})
+	}
+
+	// no alias by default
+	f := Field{Type: "uint16"}
+	(&Builder{}).aliasType(&f)
+	if f.Type != "uint16" {
+		t.Errorf("expected uint16, got %v", f.Type)
+	}
+}
+
+func Test_sortFieldsByWireOrder(t *testing.T) {
+	// slot fields come first in the declaration order, then the fields
+	// backed by a getter and a setter
+	fields := []Field{
+		{Name: "lang", Type: "String"},
+		{Name: "serverId", Type: "int"},
+		{Name: "unused", Type: "uint"},
+		{Name: "version", Type: "VersionExtended"},
+		{Name: "credentials", Type: "int", IsVector: true},
+	}
+	written := []*Field{&fields[3], &fields[0], &fields[4], &fields[1]}
+
+	var got []string
+	sorted := sortFieldsByWireOrder(fields, written)
+	for _, f := range sorted {
+		got = append(got, f.Name)
+	}
+	expected := []string{"version", "lang", "credentials", "serverId", "unused"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if sorted[4].Order != 4 {
+		t.Errorf("expected the unwritten field to come last, got order %v", sorted[4].Order)
+	}
+}
+
+func Test_Builder_extractReadMethods(t *testing.T) {
+	b := newTestBuilder("readVarUhShort", "figure", "readUnsignedShort", "failedAttempts", "push", "readByte")
+	instrs := []bytecode.Instr{
+		// this.figure = input.readVarUhShort();
+		instr("getlocal0"), instr("getlocal1"), instr("callproperty", 1, 0), instr("setproperty", 2),
+		// var _failedAttemptsLen:uint = input.readUnsignedShort();
+		instr("getlocal1"), instr("callproperty", 3, 0), instr("convert_u"), instr("setlocal2"),
+		instr("pushbyte", 0), instr("setlocal3"), instr("jump", 0), instr("label"),
+		// _val = input.readByte(); this.failedAttempts.push(_val);
+		instr("getlocal1"), instr("callproperty", 6, 0), instr("convert_i"), instr("setlocal", 4),
+		instr("getlocal0"), instr("getproperty", 4), instr("getlocal", 4), instr("callpropvoid", 5, 1),
+	}
+	fields := map[string]*Field{
+		"figure":         {Name: "figure"},
+		"failedAttempts": {Name: "failedAttempts", IsVector: true},
+	}
+	b.extractReadMethods(as3.Class{Name: "KrosmasterFigure"}, instrs, fields)
+	if got := fields["figure"].ReadMethod; got != "readVarUhShort" {
+		t.Errorf("expected readVarUhShort, got %v", got)
+	}
+	if got := fields["failedAttempts"].ReadMethod; got != "readByte" {
+		t.Errorf("expected readByte, got %v", got)
+	}
+}
+
+func Test_Builder_extractInitDefaults(t *testing.T) {
+	b := newTestBuilder("lang", "serverId", "teamId", "version", "VersionExtended", "useCertificate", "fr")
+	b.abcFile.Source.ConstantPool.UIntegers = []uint32{0, 4000000000}
+	instrs := []bytecode.Instr{
+		instr("getlocal0"), instr("pushscope"),
+		// this.lang = "fr";
+		instr("getlocal0"), instr("pushstring", 7), instr("initproperty", 1),
+		// this.serverId = -1;
+		instr("getlocal0"), instr("pushbyte", 0xff), instr("initproperty", 2),
+		// this.teamId = 4000000000;
+		instr("getlocal0"), instr("pushuint", 1), instr("convert_u"), instr("setproperty", 3),
+		// this.version = new VersionExtended();
+		instr("getlocal0"), instr("findpropstrict", 5), instr("constructprop", 5, 0), instr("initproperty", 4),
+		// this.useCertificate = false;
+		instr("getlocal0"), instr("pushfalse"), instr("initproperty", 6),
+		instr("getlocal0"), instr("constructsuper", 0), instr("returnvoid"),
+	}
+	// the slot defaults are set first, the constructor overrides them
+	declared, null := "0", "null"
+	fields := map[string]*Field{
+		"lang":           {Name: "lang"},
+		"serverId":       {Name: "serverId", Default: &declared},
+		"teamId":         {Name: "teamId"},
+		"version":        {Name: "version", Default: &null},
+		"useCertificate": {Name: "useCertificate"},
+	}
+	b.extractInitDefaults(as3.Class{Name: "IdentificationMessage"}, instrs, fields)
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"lang", `"fr"`},
+		{"serverId", "-1"},
+		{"teamId", "4000000000"},
+		{"useCertificate", "false"},
+	}
+	for _, tt := range tests {
+		if got := fields[tt.field].Default; got == nil || *got != tt.want {
+			t.Errorf("expected %v to default to %v, got %v", tt.field, tt.want, got)
+		}
+	}
+	if got := fields["version"].Default; got != nil {
+		t.Errorf("expected no default for version, got %v", *got)
+	}
+}
+
+func Test_Builder_extractSlotDefaults(t *testing.T) {
+	b := newTestBuilder("fr")
+	b.abcFile.Source.ConstantPool.Integers = []int32{0, -1}
+	b.abcFile.Source.ConstantPool.Doubles = []float64{0, 0.5}
+	slot := func(name string, kind bytecode.SlotKind, index uint32) as3.Slot {
+		return as3.Slot{Name: name, Source: bytecode.TraitsInfo{VKind: kind, VIndex: index}}
+	}
+	class := as3.Class{Name: "IdentificationMessage", InstanceTraits: as3.Traits{Slots: []as3.Slot{
+		slot("lang", bytecode.SlotKindUtf8, 1),
+		slot("serverId", bytecode.SlotKindInt, 1),
+		slot("ratio", bytecode.SlotKindDouble, 1),
+		slot("autoconnect", slotKindTrue, 0),
+		slot("version", 0, 0),
+		slot("unserialized", bytecode.SlotKindInt, 1),
+	}}}
+	fields := map[string]*Field{
+		"lang":        {Name: "lang"},
+		"serverId":    {Name: "serverId"},
+		"ratio":       {Name: "ratio"},
+		"autoconnect": {Name: "autoconnect"},
+		"version":     {Name: "version"},
+	}
+	b.extractSlotDefaults(class, fields)
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"lang", `"fr"`},
+		{"serverId", "-1"},
+		{"ratio", "0.5"},
+		{"autoconnect", "true"},
+	}
+	for _, tt := range tests {
+		if got := fields[tt.field].Default; got == nil || *got != tt.want {
+			t.Errorf("expected %v to default to %v, got %v", tt.field, tt.want, got)
+		}
+	}
+	if got := fields["version"].Default; got != nil {
+		t.Errorf("expected no default for version, got %v", *got)
+	}
+}
+
+func Test_matchPattern(t *testing.T) {
+	instrs := func(names ...string) []bytecode.Instr {
+		var instrs []bytecode.Instr
+		for _, name := range names {
+			instrs = append(instrs, instr(name))
+		}
+		return instrs
+	}
+	tests := []struct {
+		name    string
+		instrs  []bytecode.Instr
+		pattern []string
+		want    []string
+		wantN   int
+		wantOk  bool
+	}{
+		{"prefix", instrs("getproperty", "callpropvoid", "returnvoid"), []string{"getproperty", "callprop"}, []string{"getproperty", "callpropvoid", "returnvoid"}, 2, true},
+		{"mismatch", instrs("getproperty", "callproperty"), []string{"getproperty", "callpropvoid"}, nil, 0, false},
+		{"too short", instrs("getproperty"), []string{"getproperty", "callpropvoid"}, nil, 0, false},
+		{"alternative", instrs("getlex", "coerce", "callproperty"), []string{"getlex", "astypelate|coerce", "callproperty"}, []string{"getlex", "coerce", "callproperty"}, 3, true},
+		{"optional present", instrs("getproperty", "coerce_a", "callpropvoid"), []string{"getproperty", "coerce?", "callpropvoid"}, []string{"getproperty", "coerce_a", "callpropvoid"}, 3, true},
+		{"optional missing", instrs("getproperty", "callpropvoid"), []string{"getproperty", "coerce?", "callpropvoid"}, []string{"getproperty", "", "callpropvoid"}, 2, true},
+		{"optional last", instrs("getproperty"), []string{"getproperty", "nop?"}, []string{"getproperty", ""}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lined, n, ok := matchPattern(tt.instrs, tt.pattern)
+			var got []string
+			for _, l := range lined {
+				name := ""
+				if l.Model != nil {
+					name = l.Model.Name
+				}
+				got = append(got, name)
+			}
+			if ok != tt.wantOk || n != tt.wantN || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchPattern() = %v, %v, %v, want %v, %v, %v", got, n, ok, tt.want, tt.wantN, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_Builder_extractSerializeMethods_VecTypeManagerCoerce(t *testing.T) {
+	b := newTestBuilder("actors", "com.ankamagames.dofus.network.types.game.context", "GameContextActorInformations", "getTypeId", "writeShort")
+	// GameContextActorInformations is in its package and the element is
+	// read with a runtime index, multiname 6
+	pool := &b.abcFile.Source.ConstantPool
+	pool.Namespaces = append(pool.Namespaces, bytecode.NamespaceInfo{Kind: bytecode.NamespaceKindPackageNamespace, Name: 2})
+	pool.Multinames[3].Namespace = 2
+	pool.Multinames = append(pool.Multinames, bytecode.MultinameInfo{Kind: bytecode.MultinameKindMultinameL})
+
+	for _, cast := range []string{"astypelate", "coerce"} {
+		t.Run(cast, func(t *testing.T) {
+			// output.writeShort((this.actors[_i] as GameContextActorInformations).getTypeId());
+			instrs := []bytecode.Instr{
+				instr("getlocal1"), instr("getlocal0"),
+				instr("getproperty", 1), instr("getlocal2"), instr("getproperty", 6), instr("getlex", 3), instr(cast, 3), instr("callproperty", 4, 0),
+				instr("callpropvoid", 5, 1),
+			}
+			fields := map[string]*Field{"actors": {Name: "actors", IsVector: true}}
+			if _, err := b.extractSerializeMethods(as3.Class{Name: "RawData"}, "serializeAs_RawData", instrs, fields, nil); err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if !fields["actors"].UseTypeManager {
+				t.Errorf("expected actors to use the type manager")
+			}
+			if got := fields["actors"].TypeIDWriteMethod; got != "writeShort" {
+				t.Errorf("expected writeShort, got %v", got)
+			}
+		})
+	}
+}
+
+func Test_Builder_extractSerializeMethods_FixedLength(t *testing.T) {
+	b := newTestBuilder("colors", "writeInt")
+	// the element is read with a runtime index, multiname 3
+	pool := &b.abcFile.Source.ConstantPool
+	pool.Multinames = append(pool.Multinames, bytecode.MultinameInfo{Kind: bytecode.MultinameKindMultinameL})
+	// for (var _i:uint = 0; _i < 5; _i++) output.writeInt(this.colors[_i]);
+	instrs := []bytecode.Instr{
+		instr("pushbyte", 0), instr("convert_u"), instr("setlocal2"), instr("jump", 12), instr("label"),
+		instr("getlocal1"), instr("getlocal0"), instr("getproperty", 1), instr("getlocal2"), instr("getproperty", 3), instr("callpropvoid", 2, 1),
+		instr("getlocal2"), instr("increment"), instr("convert_u"), instr("setlocal2"),
+		instr("getlocal2"), instr("pushbyte", 5), instr("iflt", 0xffffeb),
+	}
+	fields := map[string]*Field{"colors": {Name: "colors", IsVector: true}}
+
+	written, err := b.extractSerializeMethods(as3.Class{Name: "CharacterCreationRequestMessage"}, "serializeAs_CharacterCreationRequestMessage", instrs, fields, nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	f := fields["colors"]
+	if len(written) != 1 || written[0] != f {
+		t.Errorf("expected colors to be written, got %v", written)
+	}
+	if !f.IsFixedLength || f.Length != 5 || f.IsDynamicLength || f.WriteMethod != "writeInt" {
+		t.Errorf("expected a fixed length of 5 written with writeInt, got %+v", *f)
+	}
+}
+
+func Test_Builder_extractSerializeMethods_VecLength(t *testing.T) {
+	b := newTestBuilder("failedAttempts", "length", "writeShort", "writeVarShort", "writeVarInt", "writeInt")
+
+	tests := []struct {
+		name       string
+		write      uint32
+		conversion string
+		wantMethod string
+		wantBits   uint8
+	}{
+		{"short", 3, "", "writeShort", 16},
+		{"var short", 4, "", "writeVarShort", 0},
+		{"var int", 5, "", "writeVarInt", 0},
+		{"int", 6, "", "writeInt", 32},
+		{"converted", 3, "convert_i", "writeShort", 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// output.writeShort(this.failedAttempts.length);
+			instrs := []bytecode.Instr{instr("getlocal1"), instr("getlocal0"), instr("getproperty", 1), instr("getproperty", 2)}
+			if tt.conversion != "" {
+				instrs = append(instrs, instr(tt.conversion))
+			}
+			instrs = append(instrs, instr("callpropvoid", tt.write, 1))
+
+			fields := map[string]*Field{"failedAttempts": {Name: "failedAttempts", IsVector: true}}
+			if _, err := b.extractSerializeMethods(as3.Class{Name: "IdentificationMessage"}, "serializeAs_IdentificationMessage", instrs, fields, nil); err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			f := fields["failedAttempts"]
+			reduceLengthPrefix(f)
+			if !f.IsDynamicLength || f.WriteLengthMethod != tt.wantMethod || f.LengthPrefixBits != tt.wantBits {
+				t.Errorf("expected a %v length of %v bits, got %v of %v bits", tt.wantMethod, tt.wantBits, f.WriteLengthMethod, f.LengthPrefixBits)
+			}
+		})
+	}
+}
+
+func Test_Builder_extractSerializeMethods_Optional(t *testing.T) {
+	b := newTestBuilder("hasLook", "writeBoolean", "look", "serializeAs_EntityLook", "cellId", "writeVarShort", "direction", "writeByte")
+	// output.writeBoolean(this.hasLook);
+	flag := []bytecode.Instr{instr("getlocal1"), instr("getlocal0"), instr("getproperty", 1), instr("callpropvoid", 2, 1)}
+	// this.look.serializeAs_EntityLook(output); output.writeVarShort(this.cellId);
+	// 14 bytes
+	block := []bytecode.Instr{
+		instr("getlocal0"), instr("getproperty", 3), instr("getlocal1"), instr("callpropvoid", 4, 1),
+		instr("getlocal1"), instr("getlocal0"), instr("getproperty", 5), instr("callpropvoid", 6, 1),
+	}
+	// output.writeByte(this.direction);
+	after := []bytecode.Instr{instr("getlocal1"), instr("getlocal0"), instr("getproperty", 7), instr("callpropvoid", 8, 1)}
+	join := func(parts ...[]bytecode.Instr) []bytecode.Instr {
+		var instrs []bytecode.Instr
+		for _, p := range parts {
+			instrs = append(instrs, p...)
+		}
+		return instrs
+	}
+
+	tests := []struct {
+		name   string
+		instrs []bytecode.Instr
+		want   map[string]string
+	}{
+		{
+			"guarded block",
+			// if (this.hasLook) { block } after
+			join(flag, []bytecode.Instr{instr("getlocal0"), instr("getproperty", 1), instr("iffalse", 14)}, block, after),
+			map[string]string{"hasLook": "", "look": "hasLook", "cellId": "hasLook", "direction": ""},
+		},
+		{
+			"empty block",
+			// if (this.hasLook) {} block after
+			join(flag, []bytecode.Instr{instr("getlocal0"), instr("getproperty", 1), instr("iffalse", 0)}, block, after),
+			map[string]string{"hasLook": "", "look": "", "cellId": "", "direction": ""},
+		},
+		{
+			"negated",
+			// if (!this.hasLook) { block } after
+			join(flag, []bytecode.Instr{instr("getlocal0"), instr("getproperty", 1), instr("iftrue", 14)}, block, after),
+			map[string]string{"hasLook": "", "look": "", "cellId": "", "direction": ""},
+		},
+		{
+			"debug",
+			// the debug instructions are part of the 16 bytes of the block
+			join(flag, []bytecode.Instr{instr("getlocal0"), instr("getproperty", 1), instr("iffalse", 16), instr("debugline", 42)}, block, after),
+			map[string]string{"hasLook": "", "look": "hasLook", "cellId": "hasLook", "direction": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]*Field{
+				"hasLook":   {Name: "hasLook", Type: "Boolean"},
+				"look":      {Name: "look", Type: "EntityLook"},
+				"cellId":    {Name: "cellId", Type: "uint"},
+				"direction": {Name: "direction", Type: "uint"},
+			}
+			if _, err := b.extractSerializeMethods(as3.Class{Name: "GameFightFighterInformations"}, "serializeAs_GameFightFighterInformations", tt.instrs, fields, nil); err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			for name, flag := range tt.want {
+				if f := fields[name]; f.PresenceFlag != flag || f.Optional != (flag != "") {
+					t.Errorf("expected %v to be guarded by %q, got %q (optional %v)", name, flag, f.PresenceFlag, f.Optional)
+				}
+			}
+		})
+	}
+}
+
+func Test_instrSize(t *testing.T) {
+	tests := []struct {
+		instr bytecode.Instr
+		want  int
+	}{
+		{instr("getlocal0"), 1},
+		{instr("getproperty", 127), 2},
+		{instr("getproperty", 128), 3},
+		{instr("callpropvoid", 300, 1), 4},
+		{instr("pushbyte", 0xff), 2},
+		{instr("iffalse", 0xfffffc), 4},
+		{instr("debug", 1, 200, 0, 0), 6},
+		{instr("lookupswitch", 10, 1, 20, 30), 11},
+	}
+	for _, tt := range tests {
+		if got := instrSize(tt.instr); got != tt.want {
+			t.Errorf("instrSize(%v %v) = %v, want %v", tt.instr.Model.Name, tt.instr.Operands, got, tt.want)
+		}
+	}
+	// a backward jump
+	if got := branchTarget(instr("jump", 0xfffffc), 10); got != 10 {
+		t.Errorf("expected 10, got %v", got)
+	}
+}
+
+func Test_Builder_extractSerializeMethods_Debug(t *testing.T) {
+	b := newTestBuilder("figure", "writeVarShort")
+	// output.writeVarShort(this.figure); compiled with debug informations
+	instrs := []bytecode.Instr{
+		instr("debugfile", 0), instr("debugline", 12), instr("getlocal1"), instr("getlocal0"),
+		instr("getproperty", 1), instr("debugline", 13), instr("nop"), instr("callpropvoid", 2, 1),
+	}
+	fields := map[string]*Field{"figure": {Name: "figure"}}
+
+	trace := &ClassTrace{}
+	if _, err := b.extractSerializeMethods(as3.Class{Name: "KrosmasterFigure"}, "serializeAs_KrosmasterFigure", instrs, fields, trace); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if fields["figure"].WriteMethod != "writeVarShort" {
+		t.Errorf("expected writeVarShort, got %v", fields["figure"].WriteMethod)
+	}
+	expected := []PatternMatch{{"handleSimpleProp", 4, "figure"}}
+	if !reflect.DeepEqual(trace.Matches, expected) {
+		t.Errorf("expected %v, got %v", expected, trace.Matches)
+	}
+}
+
+func Test_Builder_extractSerializeMethods_Strict(t *testing.T) {
+	b := newTestBuilder("look", "bonesId", "writeShort", "direction", "writeByte", "cellId", "writeVarShort")
+	b.opts.Strict = true
+	instrs := []bytecode.Instr{
+		// output.writeShort(this.look.bonesId);
+		instr("getlocal1"), instr("getlocal0"), instr("getproperty", 1), instr("getproperty", 2), instr("callpropvoid", 3, 1),
+		// output.writeByte(this.direction);
+		instr("getlocal1"), instr("getlocal0"), instr("getproperty", 4), instr("callpropvoid", 5, 1),
+		// output.writeVarShort(this.cellId + 1);
+		instr("getlocal1"), instr("getlocal0"), instr("getproperty", 6), instr("pushbyte", 1), instr("add"), instr("callpropvoid", 7, 1),
+	}
+	fields := map[string]*Field{
+		"look":      {Name: "look", Type: "EntityLook"},
+		"direction": {Name: "direction"},
+		"cellId":    {Name: "cellId"},
+	}
+
+	_, err := b.extractSerializeMethods(as3.Class{Name: "EntityDispositionInformations"}, "serializeAs_EntityDispositionInformations", instrs, fields, nil)
+	if !errors.Is(err, ErrExtractUnmatchedInstructions) {
+		t.Fatalf("expected %v, got %v", ErrExtractUnmatchedInstructions, err)
+	}
+	var unmatched unmatchedError
+	if !errors.As(err, &unmatched) {
+		t.Fatalf("expected an unmatchedError, got %v", err)
+	}
+	expected := []int{4, 14}
+	if !reflect.DeepEqual(unmatched.offsets, expected) {
+		t.Errorf("expected %v, got %v", expected, unmatched.offsets)
+	}
+}
+
+func Test_Builder_ExtractEnum_NonIntSlot(t *testing.T) {
+	abc := &as3.AbcFile{Source: &bytecode.AbcFile{
+		ConstantPool: bytecode.CpoolInfo{
+			Integers:   []int32{0, 1, 2},
+			Strings:    []string{"", "int", "labels"},
+			Multinames: []bytecode.MultinameInfo{{}, {Name: 1}},
+		},
+	}}
+	slot := func(name string, kind bytecode.SlotKind, index uint32) as3.Slot {
+		return as3.Slot{Name: name, Source: bytecode.TraitsInfo{Typename: 1, VKind: kind, VIndex: index}}
+	}
+	class := as3.Class{Name: "ChatActivableChannelsEnum", ClassTraits: as3.Traits{Slots: []as3.Slot{
+		slot("CHANNEL_GLOBAL", bytecode.SlotKindInt, 1),
+		slot("LABELS", bytecode.SlotKindUtf8, 2),
+		slot("CHANNEL_TEAM", bytecode.SlotKindInt, 2),
+	}}}
+
+	b := &Builder{abcFile: abc}
+	got, err := b.ExtractEnum(class)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := []EnumValue{{"CHANNEL_GLOBAL", 1}, {"CHANNEL_TEAM", 2}}
+	if !reflect.DeepEqual(got.Values, expected) {
+		t.Errorf("expected %v, got %v", expected, got.Values)
+	}
+
+	b = &Builder{abcFile: abc, opts: BuildOptions{Strict: true}}
+	if _, err = b.ExtractEnum(class); !errors.Is(err, ErrExtractEnumValueNotInt) {
+		t.Errorf("expected %v, got %v", ErrExtractEnumValueNotInt, err)
+	}
+}
+
+func Test_Builder_ExtractEnum_UIntSlot(t *testing.T) {
+	abc := &as3.AbcFile{Source: &bytecode.AbcFile{
+		ConstantPool: bytecode.CpoolInfo{
+			Integers:  []int32{0, 1},
+			UIntegers: []uint32{0, 0x80000000},
+			Doubles:   []float64{0, 2, 2.5},
+		},
+	}}
+	slot := func(name string, kind bytecode.SlotKind, index uint32) as3.Slot {
+		return as3.Slot{Name: name, Source: bytecode.TraitsInfo{VKind: kind, VIndex: index}}
+	}
+	class := as3.Class{Name: "PlayerStatusEnum", ClassTraits: as3.Traits{Slots: []as3.Slot{
+		slot("AVAILABLE", bytecode.SlotKindUInt, 0),
+		slot("SOLO", bytecode.SlotKindUInt, 1),
+	}}}
+
+	b := &Builder{abcFile: abc}
+	got, err := b.ExtractEnum(class)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got.Underlying != "uint" || got.BaseType != "uint32" {
+		t.Errorf("expected an uint32 enumeration, got %v %v", got.Underlying, got.BaseType)
+	}
+	if v := uint32(got.Values[1].Value); v != 0x80000000 {
+		t.Errorf("expected %v, got %v", uint32(0x80000000), v)
+	}
+
+	class.ClassTraits.Slots = []as3.Slot{
+		slot("GLOBAL", bytecode.SlotKindInt, 1),
+		slot("TEAM", bytecode.SlotKindDouble, 1),
+		slot("RATIO", bytecode.SlotKindDouble, 2),
+	}
+	got, err = b.ExtractEnum(class)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := []EnumValue{{"GLOBAL", 1}, {"TEAM", 2}}
+	if !reflect.DeepEqual(got.Values, expected) {
+		t.Errorf("expected %v, got %v", expected, got.Values)
+	}
+}
+
+func Test_Builder_hashFuncName(t *testing.T) {
+	b := newTestBuilder("HASH_FUNCTION", "hash", "writePacket")
+	tests := []struct {
+		name     string
+		instrs   []bytecode.Instr
+		wantUsed bool
+		wantName string
+	}{
+		{
+			"called",
+			// if (HASH_FUNCTION != null) HASH_FUNCTION(data);
+			[]bytecode.Instr{
+				instr("getlex", 1), instr("pushnull"), instr("ifeq", 0),
+				instr("getlex", 1), instr("getglobalscope"), instr("getlocal2"), instr("call", 1), instr("pop"),
+				instr("findpropstrict", 3), instr("getlocal1"), instr("getlocal2"), instr("callpropvoid", 3, 2),
+			},
+			true,
+			"",
+		},
+		{
+			"method",
+			// HASH_FUNCTION.hash(data);
+			[]bytecode.Instr{instr("getlex", 1), instr("getlocal2"), instr("callpropvoid", 2, 1)},
+			true,
+			"hash",
+		},
+		{
+			"none",
+			[]bytecode.Instr{instr("findpropstrict", 3), instr("getlocal1"), instr("getlocal2"), instr("callpropvoid", 3, 2)},
+			false,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used, name := b.hashFuncName(tt.instrs)
+			if used != tt.wantUsed || name != tt.wantName {
+				t.Errorf("Builder.hashFuncName() = %v, %v, want %v, %v", used, name, tt.wantUsed, tt.wantName)
+			}
+		})
+	}
+}
+
+func Test_Builder_extractHashKey(t *testing.T) {
+	b := newTestBuilder()
+	other := newTestBuilder("HASH_FUNCTION", "ed25519")
+	b.others = []*Builder{other}
+	other.abcFile.Classes = []as3.Class{{Name: "NetworkMessage", ClassTraits: as3.Traits{Slots: []as3.Slot{
+		{Name: "HASH_FUNCTION", Source: bytecode.TraitsInfo{Kind: bytecode.TraitsInfoConst, VKind: bytecode.SlotKindUtf8, VIndex: 2}},
+	}}}}
+
+	got, err := b.extractHashKey("HASH_FUNCTION")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if string(got) != "ed25519" {
+		t.Errorf("expected the key of the other tag, got %q", got)
+	}
+	if got, _ = b.extractHashKey("HASH_KEY"); got != nil {
+		t.Errorf("expected nil, got %q", got)
+	}
+}
+
+func Test_Builder_staticString(t *testing.T) {
+	b := newTestBuilder("HASH_FUNCTION", "ed25519", "VERSION")
+	// VERSION = null; HASH_FUNCTION = "ed25519";
+	instrs := []bytecode.Instr{
+		instr("getlocal0"), instr("pushscope"),
+		instr("findproperty", 3), instr("pushnull"), instr("initproperty", 3),
+		instr("findproperty", 1), instr("pushstring", 2), instr("initproperty", 1),
+		instr("returnvoid"),
+	}
+	if got, ok := b.staticString(instrs, "HASH_FUNCTION"); !ok || got != "ed25519" {
+		t.Errorf("expected ed25519, got %v, %v", got, ok)
+	}
+	if got, ok := b.staticString(instrs, "VERSION"); ok {
+		t.Errorf("expected no string, got %v", got)
+	}
+}
+
+func Test_Builder_extractMetadata(t *testing.T) {
+	b := newTestBuilder("HelloGameMessage", "Deprecated", "since", "2.40", "Trusted", "HelloConnectMessage", "com.ankamagames.dofus.network.messages.game.approach")
+	// the second HelloGameMessage is declared in a package, multiname 8
+	pool := &b.abcFile.Source.ConstantPool
+	pool.Namespaces = append(pool.Namespaces, bytecode.NamespaceInfo{Kind: bytecode.NamespaceKindPackageNamespace, Name: 7})
+	pool.Multinames = append(pool.Multinames, bytecode.MultinameInfo{Kind: bytecode.MultinameKindQName, Name: 1, Namespace: 2})
+	b.abcFile.Source.Metadatas = []bytecode.MetadataInfo{
+		{Name: 2, Items: []bytecode.ItemInfo{{Key: 3, Value: 4}, {Key: 0, Value: 1}}},
+		{Name: 5},
+	}
+	b.abcFile.Source.Scripts = []bytecode.ScriptInfo{{Traits: []bytecode.TraitsInfo{
+		{Name: 6, Kind: bytecode.TraitsInfoClass},
+		{Name: 1, Kind: bytecode.TraitsInfoClass, Metadata: []uint32{1}},
+		{Name: 8, Kind: bytecode.TraitsInfoClass, Metadata: []uint32{0, 1}},
+	}}}
+
+	got := b.extractMetadata(as3.Class{Name: "HelloGameMessage", Namespace: "com.ankamagames.dofus.network.messages.game.approach"})
+	expected := map[string][]string{"Deprecated": {"since=2.40", "HelloGameMessage"}, "Trusted": nil}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	got = b.extractMetadata(as3.Class{Name: "HelloGameMessage"})
+	expected = map[string][]string{"Trusted": nil}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got = b.extractMetadata(as3.Class{Name: "HelloConnectMessage"}); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+}
+
+func Test_Builder_extractClassID(t *testing.T) {
+	b := &Builder{abcFile: &as3.AbcFile{Source: &bytecode.AbcFile{
+		ConstantPool: bytecode.CpoolInfo{Integers: []int32{0, 101}},
+	}}}
+	protocolID := func(kind bytecode.TraitsInfoKind) as3.Slot {
+		return as3.Slot{Name: "protocolId", Source: bytecode.TraitsInfo{Kind: kind, VKind: bytecode.SlotKindInt, VIndex: 1}}
+	}
+
+	tests := []struct {
+		name         string
+		slots        []as3.Slot
+		wantID       uint16
+		wantAbstract bool
+		wantErr      error
+	}{
+		{"id", []as3.Slot{protocolID(bytecode.TraitsInfoConst)}, 101, false, nil},
+		{"no id", nil, 0, true, nil},
+		{"not const", []as3.Slot{protocolID(bytecode.TraitsInfoSlot)}, 0, false, ErrExtractProtocolIDNotConst},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := as3.Class{Name: "HelloGameMessage", ClassTraits: as3.Traits{Slots: tt.slots}}
+			id, abstract, err := b.extractClassID(class)
+			if err != tt.wantErr {
+				t.Fatalf("Builder.extractClassID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.wantID || abstract != tt.wantAbstract {
+				t.Errorf("Builder.extractClassID() = %v, %v, want %v, %v", id, abstract, tt.wantID, tt.wantAbstract)
 			}
 		})
 	}
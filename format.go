@@ -0,0 +1,57 @@
+package d2protocolparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String summarizes the wire shape of f, like `fightId uint16 [writeShort]`,
+// `content []uint8 [writeByte] dyn-len[writeVarInt]` or `autoconnect bool bbw#0`
+func (f Field) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v %v%v", f.Name, strings.Repeat("[]", f.Dimensions()), f.Type)
+	if f.UseBBW {
+		fmt.Fprintf(&sb, " bbw#%v", f.BBWPosition)
+	} else if f.WriteMethod != "" {
+		fmt.Fprintf(&sb, " [%v]", f.WriteMethod)
+	}
+	if f.IsDynamicLength {
+		fmt.Fprintf(&sb, " dyn-len[%v]", f.WriteLengthMethod)
+	}
+	if f.IsFixedLength {
+		fmt.Fprintf(&sb, " len=%v", f.Length)
+	}
+	if f.UseTypeManager {
+		sb.WriteString(" type-manager")
+	}
+	if f.PresenceFlag != "" {
+		fmt.Fprintf(&sb, " if %v", f.PresenceFlag)
+	}
+	return sb.String()
+}
+
+// String lists the name, the parent, the protocol id and the fields of c,
+// one field per line
+func (c Class) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v (%v)", c.Name, c.ProtocolID)
+	if c.Parent != "" {
+		fmt.Fprintf(&sb, " extends %v", c.Parent)
+	}
+	if c.UseHashFunc {
+		sb.WriteString(" hash-func")
+	}
+	for _, f := range c.Fields {
+		fmt.Fprintf(&sb, "\n\t%v", f)
+	}
+	return sb.String()
+}
+
+// String summarizes the version and the size of p
+func (p *Protocol) String() string {
+	v := p.Version.String()
+	if p.Version.BuildType != "" {
+		v += " " + p.Version.BuildType
+	}
+	return fmt.Sprintf("protocol %v: %v messages, %v types, %v enums", v, len(p.Messages), len(p.Types), len(p.Enums))
+}
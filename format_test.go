@@ -0,0 +1,68 @@
+package d2protocolparser
+
+import "testing"
+
+func TestField_String(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  string
+	}{
+		{"scalar", Field{Name: "fightId", Type: "uint16", WriteMethod: "writeShort"}, "fightId uint16 [writeShort]"},
+		{"bbw", Field{Name: "autoconnect", Type: "bool", UseBBW: true}, "autoconnect bool bbw#0"},
+		{
+			"dynamic vector",
+			Field{Name: "content", Type: "uint8", WriteMethod: "writeByte", IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeVarInt"},
+			"content []uint8 [writeByte] dyn-len[writeVarInt]",
+		},
+		{
+			"fixed vector",
+			Field{Name: "colors", Type: "int32", WriteMethod: "writeInt", IsVector: true, VectorDepth: 1, IsFixedLength: true, Length: 5},
+			"colors []int32 [writeInt] len=5",
+		},
+		{
+			"type manager vector",
+			Field{Name: "characters", Type: "CharacterBaseInformations", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort", UseTypeManager: true},
+			"characters []CharacterBaseInformations dyn-len[writeShort] type-manager",
+		},
+		{"optional", Field{Name: "look", Type: "EntityLook", PresenceFlag: "hasLook"}, "look EntityLook if hasLook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.field.String(); got != tt.want {
+				t.Errorf("Field.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClass_String(t *testing.T) {
+	c := Class{
+		Name:        "IdentificationSuccessWithLoginTokenMessage",
+		Parent:      "IdentificationSuccessMessage",
+		ProtocolID:  6209,
+		UseHashFunc: true,
+		Fields: []Field{
+			{Name: "loginToken", Type: "string", WriteMethod: "writeUTF"},
+			{Name: "autoconnect", Type: "bool", UseBBW: true},
+		},
+	}
+	expected := "IdentificationSuccessWithLoginTokenMessage (6209) extends IdentificationSuccessMessage hash-func\n" +
+		"\tloginToken string [writeUTF]\n" +
+		"\tautoconnect bool bbw#0"
+	if got := c.String(); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestProtocol_String(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{{Name: "HelloGameMessage"}, {Name: "HelloConnectMessage"}},
+		Types:    []Class{{Name: "EntityLook"}},
+		Version:  Version{2, 39, 0, 117122, 0, "RELEASE"},
+	}
+	expected := "protocol 2.39.0.117122.0 RELEASE: 2 messages, 1 types, 0 enums"
+	if got := p.String(); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
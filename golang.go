@@ -0,0 +1,178 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// goTypesMap maps the as3 types that could not be reduced to Go types
+var goTypesMap = map[string]string{
+	"int":     "int32",
+	"uint":    "uint32",
+	"Number":  "float64",
+	"String":  "string",
+	"Boolean": "bool",
+}
+
+// goType returns the Go type of f. Fixed-length vectors are arrays so that
+// their length can not differ from the one of the wire format.
+func goType(f Field) string {
+	if f.IsByteArray {
+		return "[]byte"
+	}
+	dims := f.Dimensions()
+	if f.IsFixedLength && dims > 0 {
+		return fmt.Sprintf("[%v]", f.Length) + strings.Repeat("[]", dims-1) + goElemType(f)
+	}
+	return strings.Repeat("[]", dims) + goElemType(f)
+}
+
+// goElemType returns the Go type of a single value of f, the type of the
+// elements for a vector
+func goElemType(f Field) string {
+	if f.EnumRef != nil {
+		return f.EnumRef.Name
+	}
+	if t, ok := goTypesMap[f.Type]; ok {
+		return t
+	}
+	return f.Type
+}
+
+func goExportedName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[n:]
+}
+
+func writeGoStruct(buf *bytes.Buffer, c Class) {
+	// an abstract class has no protocol id
+	if !c.Abstract {
+		fmt.Fprintf(buf, "// %vProtocolID is the protocol id of %v\n", c.Name, c.Name)
+		fmt.Fprintf(buf, "const %vProtocolID uint16 = %v\n\n", c.Name, c.ProtocolID)
+	}
+	fmt.Fprintf(buf, "// %v is %v.%v\n", c.Name, c.Namespace, c.Name)
+	fmt.Fprintf(buf, "type %v struct {\n", c.Name)
+	if c.Parent != "" {
+		fmt.Fprintf(buf, "%v\n", c.Parent)
+	}
+	for _, f := range c.Fields {
+		fmt.Fprintf(buf, "%v %v\n", goExportedName(f.Name), goType(f))
+	}
+	buf.WriteString("}\n\n")
+}
+
+// GenerateGo writes the Go struct definitions of every type and message of
+// the protocol to w, in the package pkg. Parents are embedded in their
+// children.
+func GenerateGo(p *Protocol, w io.Writer, pkg string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by d2protocolparser. DO NOT EDIT.\n\npackage %v\n\n", pkg)
+	for _, c := range p.Types {
+		writeGoStruct(&buf, c)
+	}
+	for _, c := range p.Messages {
+		writeGoStruct(&buf, c)
+	}
+	return writeGoSource(&buf, w)
+}
+
+// goConstName converts an enumeration value name like ALIGNMENT_UNKNOWN to
+// AlignmentUnknown
+func goConstName(name string) string {
+	var res string
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if strings.ToUpper(part) == part {
+			part = strings.ToLower(part)
+		}
+		res += goExportedName(part)
+	}
+	return res
+}
+
+func writeGoEnum(buf *bytes.Buffer, e Enum) {
+	fmt.Fprintf(buf, "// %v is an enumeration of the protocol\n", e.Name)
+	if e.Underlying == "uint" {
+		fmt.Fprintf(buf, "type %v uint32\n\n", e.Name)
+	} else {
+		fmt.Fprintf(buf, "type %v int32\n\n", e.Name)
+	}
+
+	buf.WriteString("const (\n")
+	for _, v := range e.Values {
+		if e.Underlying == "uint" {
+			fmt.Fprintf(buf, "%v%v %v = %v\n", e.Name, goConstName(v.Name), e.Name, uint32(v.Value))
+		} else {
+			fmt.Fprintf(buf, "%v%v %v = %v\n", e.Name, goConstName(v.Name), e.Name, v.Value)
+		}
+	}
+	buf.WriteString(")\n\n")
+
+	// Several names can share the same value, only the first one is used
+	// when converting a value to a string
+	fmt.Fprintf(buf, "var %vNames = map[%v]string{\n", goUnexportedName(e.Name), e.Name)
+	seen := map[int32]bool{}
+	for _, v := range e.Values {
+		if seen[v.Value] {
+			continue
+		}
+		seen[v.Value] = true
+		fmt.Fprintf(buf, "%v%v: %q,\n", e.Name, goConstName(v.Name), v.Name)
+	}
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "var %vValues = map[string]%v{\n", goUnexportedName(e.Name), e.Name)
+	for _, v := range e.Values {
+		fmt.Fprintf(buf, "%q: %v%v,\n", v.Name, e.Name, goConstName(v.Name))
+	}
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "func (e %v) String() string {\n", e.Name)
+	fmt.Fprintf(buf, "if s, ok := %vNames[e]; ok {\nreturn s\n}\n", goUnexportedName(e.Name))
+	// the values of a uint enumeration are not reinterpreted as signed
+	underlying := "int32"
+	if e.Underlying == "uint" {
+		underlying = "uint32"
+	}
+	fmt.Fprintf(buf, "return fmt.Sprintf(\"%v(%%d)\", %v(e))\n}\n\n", e.Name, underlying)
+
+	fmt.Fprintf(buf, "// Parse%v returns the %v value with the given name\n", e.Name, e.Name)
+	fmt.Fprintf(buf, "func Parse%v(s string) (%v, bool) {\n", e.Name, e.Name)
+	fmt.Fprintf(buf, "v, ok := %vValues[s]\nreturn v, ok\n}\n\n", goUnexportedName(e.Name))
+}
+
+func goUnexportedName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[n:]
+}
+
+// GenerateGoEnums writes the Go definitions of every enumeration of the
+// protocol to w, in the package pkg. Each enumeration has its own type along
+// with a String method and a Parse function.
+func GenerateGoEnums(p *Protocol, w io.Writer, pkg string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by d2protocolparser. DO NOT EDIT.\n\npackage %v\n\n", pkg)
+	if len(p.Enums) > 0 {
+		buf.WriteString("import \"fmt\"\n\n")
+	}
+	for _, e := range p.Enums {
+		writeGoEnum(&buf, e)
+	}
+	return writeGoSource(&buf, w)
+}
+
+func writeGoSource(buf *bytes.Buffer, w io.Writer) error {
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return newError(err, "generated go code is invalid")
+	}
+	_, err = w.Write(src)
+	return err
+}
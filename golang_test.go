@@ -0,0 +1,133 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func goldenProtocol() *Protocol {
+	p := &Protocol{
+		Messages: []Class{
+			{
+				Name:       "IdentificationMessage",
+				Namespace:  "com.ankamagames.dofus.network.messages.connection",
+				ProtocolID: 4,
+				Fields: []Field{
+					{Name: "autoconnect", Type: "bool", UseBBW: true, BBWPosition: 0},
+					{Name: "useCertificate", Type: "bool", UseBBW: true, BBWPosition: 1},
+					{Name: "useLoginToken", Type: "bool", UseBBW: true, BBWPosition: 2},
+					{Name: "version", Type: "VersionExtended"},
+					{Name: "lang", Type: "string", WriteMethod: "writeUTF", Method: "String"},
+					{Name: "credentials", Type: "int8", WriteMethod: "writeByte", Method: "Int8", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarInt"},
+					{Name: "serverId", Type: "int16", WriteMethod: "writeShort", Method: "Int16"},
+					{Name: "sessionOptionalSalt", Type: "int64", WriteMethod: "writeVarLong", Method: "VarInt64"},
+					{Name: "failedAttempts", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort", LengthPrefixBits: 16},
+				},
+			},
+			{
+				Name:       "IdentificationSuccessWithLoginTokenMessage",
+				Namespace:  "com.ankamagames.dofus.network.messages.connection",
+				Parent:     "IdentificationSuccessMessage",
+				ProtocolID: 6209,
+				Fields: []Field{
+					{Name: "loginToken", Type: "string", WriteMethod: "writeUTF", Method: "String"},
+				},
+			},
+			{
+				Name:       "BasicCharactersListMessage",
+				Namespace:  "com.ankamagames.dofus.network.messages.game.character.choice",
+				ProtocolID: 6475,
+				Fields: []Field{
+					{Name: "characters", Type: "CharacterBaseInformations", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort", LengthPrefixBits: 16, UseTypeManager: true},
+				},
+			},
+		},
+		Types: []Class{
+			{
+				Name:       "GameContextActorInformations",
+				Namespace:  "com.ankamagames.dofus.network.types.game.context",
+				ProtocolID: 150,
+				Fields: []Field{
+					{Name: "contextualId", Type: "float64", WriteMethod: "writeDouble", Method: "Double"},
+					{Name: "look", Type: "EntityLook"},
+					{Name: "disposition", Type: "EntityDispositionInformations", UseTypeManager: true},
+				},
+			},
+			{
+				Name:       "KrosmasterFigure",
+				Namespace:  "com.ankamagames.dofus.network.types.web.krosmaster",
+				ProtocolID: 397,
+				Fields: []Field{
+					{Name: "uid", Type: "string", WriteMethod: "writeUTF", Method: "String"},
+					{Name: "figure", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16"},
+					{Name: "pedestal", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16"},
+					{Name: "bound", Type: "bool", WriteMethod: "writeBoolean", Method: "Boolean"},
+				},
+			},
+		},
+		Enums: []Enum{
+			{"AlignmentSideEnum", []EnumValue{
+				{"ALIGNMENT_UNKNOWN", -2},
+				{"ALIGNMENT_WITHOUT", -1},
+				{"ALIGNMENT_NEUTRAL", 0},
+				{"ALIGNMENT_ANGEL", 1},
+				{"ALIGNMENT_EVIL", 2},
+				{"ALIGNMENT_MERCENARY", 3},
+			}, "int", false, "int8"},
+		},
+	}
+	p.Link()
+	return p
+}
+
+func TestGenerateGo(t *testing.T) {
+	expected, err := ioutil.ReadFile("./fixtures/protocol.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = GenerateGo(goldenProtocol(), &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), buf.String())
+	}
+}
+
+func TestGenerateGoEnums(t *testing.T) {
+	expected, err := ioutil.ReadFile("./fixtures/enums.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := goldenProtocol()
+	p.Enums = append(p.Enums, Enum{"AccessoryPreviewErrorEnum", []EnumValue{
+		{"PREVIEW_ERROR", 0},
+		{"PREVIEW_COOLDOWN", 1},
+		{"PREVIEW_BAD_ITEM", 2},
+		{"PREVIEW_DEFAULT_ERROR", 0},
+	}, "uint", false, "uint8"})
+
+	var buf bytes.Buffer
+	if err = GenerateGoEnums(p, &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), buf.String())
+	}
+}
+
+func TestGenerateGo_Abstract(t *testing.T) {
+	p := &Protocol{Types: []Class{{Name: "AbstractSocialGroupInfos", Abstract: true}}}
+
+	var buf bytes.Buffer
+	if err := GenerateGo(p, &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if strings.Contains(buf.String(), "ProtocolID") {
+		t.Errorf("expected no protocol id, got %v", buf.String())
+	}
+}
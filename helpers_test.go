@@ -0,0 +1,53 @@
+package d2protocolparser
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+
+	"github.com/kelvyne/as3"
+	"github.com/kelvyne/as3/bytecode"
+)
+
+// instr returns an instruction of a synthetic method body
+func instr(name string, operands ...uint32) bytecode.Instr {
+	return bytecode.Instr{Model: &bytecode.InstrModel{Name: name}, Operands: operands}
+}
+
+// newTestBuilder returns a builder whose constant pool holds names, starting
+// at index 1, along with a public QName of each name at the same index so
+// that instr("getproperty", i) references names[i-1]
+func newTestBuilder(names ...string) *Builder {
+	pool := bytecode.CpoolInfo{
+		Strings:    append([]string{""}, names...),
+		Namespaces: []bytecode.NamespaceInfo{{}, {Kind: bytecode.NamespaceKindPackageNamespace}},
+		Multinames: []bytecode.MultinameInfo{{}},
+	}
+	for i := range names {
+		pool.Multinames = append(pool.Multinames, bytecode.MultinameInfo{Kind: bytecode.MultinameKindQName, Name: uint32(i + 1), Namespace: 1})
+	}
+	return &Builder{abcFile: &as3.AbcFile{Source: &bytecode.AbcFile{ConstantPool: pool}}}
+}
+
+// typeCheckGo type checks generated Go sources as the files of a single
+// package without imports
+func typeCheckGo(sources ...string) error {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for i, src := range sources {
+		f, err := parser.ParseFile(fset, fmt.Sprintf("generated%v.go", i), src, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	_, err := (&types.Config{}).Check("protocol", fset, files, nil)
+	return err
+}
+
+// literal returns a pointer to an AS3 literal, for the expected defaults
+func literal(s string) *string {
+	return &s
+}
@@ -0,0 +1,39 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// GenerateMessageIDTable writes two Go maps to w, in the package pkg:
+// IDToName maps the protocol id of every message to its name and NameToID is
+// its inverse. Messages sharing a protocol id are an error, abstract messages
+// are left out.
+func GenerateMessageIDTable(p *Protocol, pkg string, w io.Writer) error {
+	if err := verifyProtocolIDs(p); err != nil {
+		return newError(err, "message id table generation failed")
+	}
+	var messages []Class
+	for _, m := range sortedClasses(p.Messages) {
+		if !m.Abstract {
+			messages = append(messages, m)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by d2protocolparser. DO NOT EDIT.\n\npackage %v\n\n", pkg)
+	buf.WriteString("// IDToName maps the protocol id of every message to its name\n")
+	buf.WriteString("var IDToName = map[uint16]string{\n")
+	for _, m := range messages {
+		fmt.Fprintf(&buf, "%v: %q,\n", m.ProtocolID, m.Name)
+	}
+	buf.WriteString("}\n\n")
+	buf.WriteString("// NameToID maps the name of every message to its protocol id\n")
+	buf.WriteString("var NameToID = map[string]uint16{\n")
+	for _, m := range messages {
+		fmt.Fprintf(&buf, "%q: %v,\n", m.Name, m.ProtocolID)
+	}
+	buf.WriteString("}\n")
+	return writeGoSource(&buf, w)
+}
@@ -0,0 +1,47 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGenerateMessageIDTable(t *testing.T) {
+	expected := `// Code generated by d2protocolparser. DO NOT EDIT.
+
+package protocol
+
+// IDToName maps the protocol id of every message to its name
+var IDToName = map[uint16]string{
+	4:    "IdentificationMessage",
+	6209: "IdentificationSuccessWithLoginTokenMessage",
+	6475: "BasicCharactersListMessage",
+}
+
+// NameToID maps the name of every message to its protocol id
+var NameToID = map[string]uint16{
+	"IdentificationMessage":                      4,
+	"IdentificationSuccessWithLoginTokenMessage": 6209,
+	"BasicCharactersListMessage":                 6475,
+}
+`
+	p := goldenProtocol()
+	p.Messages = append(p.Messages, Class{Name: "AbstractGameActionMessage", Abstract: true})
+	var buf bytes.Buffer
+	if err := GenerateMessageIDTable(p, "protocol", &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected %v, got %v", expected, buf.String())
+	}
+}
+
+func TestGenerateMessageIDTable_DuplicateID(t *testing.T) {
+	p := goldenProtocol()
+	p.Messages[1].ProtocolID = p.Messages[0].ProtocolID
+	err := GenerateMessageIDTable(p, "protocol", ioutil.Discard)
+	if !errors.Is(err, ErrVerifyDuplicateProtocolID) {
+		t.Errorf("expected %v, got %v", ErrVerifyDuplicateProtocolID, err)
+	}
+}
@@ -0,0 +1,86 @@
+package d2protocolparser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+func sortedClasses(classes []Class) []Class {
+	if classes == nil {
+		return nil
+	}
+	sorted := make([]Class, len(classes))
+	copy(sorted, classes)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ProtocolID != sorted[j].ProtocolID {
+			return sorted[i].ProtocolID < sorted[j].ProtocolID
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func sortedEnums(enums []Enum) []Enum {
+	if enums == nil {
+		return nil
+	}
+	sorted := make([]Enum, len(enums))
+	copy(sorted, enums)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// WriteJSON writes the protocol to w as JSON. Messages and types are sorted by
+// protocol id then by name, and enumerations by name, so that the output does
+// not change between two builds of the same DofusInvoker.swf
+func (p *Protocol) WriteJSON(w io.Writer) error {
+	sorted := Protocol{
+		Messages: sortedClasses(p.Messages),
+		Types:    sortedClasses(p.Types),
+		Enums:    sortedEnums(p.Enums),
+		Version:  p.Version,
+
+		SourceHash: p.SourceHash,
+		Filtered:   p.Filtered,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(sorted)
+}
+
+// Fingerprint returns the hex encoded SHA-256 of the sorted messages, types
+// and enumerations of p. It does not depend on the version nor on the source
+// hash, so two builds with the same structure have the same fingerprint.
+func (p *Protocol) Fingerprint() string {
+	sorted := Protocol{
+		Messages: sortedClasses(p.Messages),
+		Types:    sortedClasses(p.Types),
+		Enums:    sortedEnums(p.Enums),
+	}
+	h := sha256.New()
+	// encoding a protocol can not fail, it only contains plain values
+	_ = json.NewEncoder(h).Encode(sorted)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LoadProtocol reads a protocol previously written with WriteJSON and
+// verifies it like Build does. The field types of a filtered protocol are
+// not resolved.
+func LoadProtocol(r io.Reader) (*Protocol, error) {
+	var p Protocol
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, newError(err, "json decoding failed")
+	}
+
+	if err := verify(&p, !p.Filtered); err != nil {
+		return nil, newError(err, "verification error")
+	}
+	p.Link()
+	p.index = &protocolIndex{}
+	return &p, nil
+}
@@ -0,0 +1,146 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProtocol_WriteJSON(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "HelloGameMessage", Namespace: "com.ankamagames.dofus.network.messages.game.approach", ProtocolID: 101},
+			{Name: "CharacterLevelUpMessage", Namespace: "com.ankamagames.dofus.network.messages.game.character.stats", ProtocolID: 5670, Fields: []Field{
+				{Name: "newLevel", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8"},
+			}},
+			{Name: "IdentificationMessage", Namespace: "com.ankamagames.dofus.network.messages.connection", ProtocolID: 4, Fields: []Field{
+				{Name: "autoconnect", Type: "bool", UseBBW: true},
+				{Name: "version", Type: "VersionExtended"},
+			}},
+		},
+		Types: []Class{
+			{Name: "VersionExtended", Namespace: "com.ankamagames.dofus.network.types.version", ProtocolID: 393},
+		},
+		Enums: []Enum{
+			{"AlignmentSideEnum", []EnumValue{{"ALIGNMENT_UNKNOWN", -2}}, "int", false, "int8"},
+			{"AccessoryPreviewErrorEnum", []EnumValue{{"PREVIEW_ERROR", 0}}, "uint", false, "uint8"},
+		},
+		Version: Version{2, 42, 0, 1027565, 0, "RELEASE"},
+	}
+
+	var first bytes.Buffer
+	if err := p.WriteJSON(&first); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	var decoded Protocol
+	if err := json.Unmarshal(first.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if decoded.Messages[0].Name != "IdentificationMessage" || decoded.Enums[0].Name != "AccessoryPreviewErrorEnum" {
+		t.Errorf("expected sorted sections, got %v and %v", decoded.Messages[0].Name, decoded.Enums[0].Name)
+	}
+
+	var second bytes.Buffer
+	if err := decoded.WriteJSON(&second); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("expected %v, got %v", first.String(), second.String())
+	}
+
+	expected := Protocol{
+		Messages: sortedClasses(p.Messages),
+		Types:    p.Types,
+		Enums:    sortedEnums(p.Enums),
+		Version:  p.Version,
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %v, got %v", expected, decoded)
+	}
+}
+
+func TestLoadProtocol(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "GameContextActorInformationsMessage", ProtocolID: 1, Fields: []Field{
+				{Name: "informations", Type: "GameContextActorInformations"},
+			}},
+		},
+		Types: []Class{
+			{Name: "GameContextActorInformations", ProtocolID: 150, Fields: []Field{
+				{Name: "contextualId", Type: "float64", WriteMethod: "writeDouble", Method: "Double"},
+			}},
+		},
+		Version: Version{2, 39, 0, 117122, 0, "RELEASE"},
+	}
+	p.Link()
+
+	var buf bytes.Buffer
+	if err := p.WriteJSON(&buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	loaded, err := LoadProtocol(&buf)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if loaded.index == nil {
+		t.Errorf("expected loaded protocol to be indexed")
+	}
+	// the index is filled on the first lookup, it is not part of the content
+	p.index = loaded.index
+	if !reflect.DeepEqual(loaded, p) {
+		t.Errorf("expected %v, got %v", p, loaded)
+	}
+	if loaded.Messages[0].Fields[0].TypeRef != &loaded.Types[0] {
+		t.Errorf("expected loaded protocol to be linked")
+	}
+
+	invalid := `{"Types": [{"Name": "Broken", "Fields": [{"Name": "values", "Type": "uint16", "WriteMethod": "writeShort", "IsVector": true}]}]}`
+	if _, err = LoadProtocol(bytes.NewBufferString(invalid)); err == nil {
+		t.Errorf("expected verification error, got nil")
+	}
+
+	// a filtered build does not contain the types of its fields
+	filtered := &Protocol{Messages: p.Messages, Filtered: true}
+	buf.Reset()
+	if err = filtered.WriteJSON(&buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if _, err = LoadProtocol(&buf); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
+
+func TestProtocol_Fingerprint(t *testing.T) {
+	p := goldenProtocol()
+	fingerprint := p.Fingerprint()
+	if len(fingerprint) != 64 {
+		t.Errorf("expected a SHA-256 hex digest, got %v", fingerprint)
+	}
+
+	same := goldenProtocol()
+	same.Version = Version{2, 42, 0, 1027565, 0, "RELEASE"}
+	same.SourceHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	same.Messages[0], same.Messages[1] = same.Messages[1], same.Messages[0]
+	if got := same.Fingerprint(); got != fingerprint {
+		t.Errorf("expected %v, got %v", fingerprint, got)
+	}
+
+	changes := []func(p *Protocol){
+		func(p *Protocol) { p.Messages[0].ProtocolID = 5 },
+		func(p *Protocol) { p.Types[0].Fields[0].Type = "float32" },
+		func(p *Protocol) {
+			p.Types[1].Fields[1], p.Types[1].Fields[2] = p.Types[1].Fields[2], p.Types[1].Fields[1]
+		},
+		func(p *Protocol) { p.Enums[0].Values[0].Value = -3 },
+	}
+	for i, change := range changes {
+		changed := goldenProtocol()
+		change(changed)
+		if got := changed.Fingerprint(); got == fingerprint {
+			t.Errorf("expected change %v to change the fingerprint", i)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package d2protocolparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// jsonSchema is a JSON Schema node, keys are sorted by encoding/json so the
+// output is stable
+type jsonSchema map[string]interface{}
+
+// jsonSchemaRanges gives the bounds of the integer types, 64 bits integers
+// are only bounded by their sign
+var jsonSchemaRanges = map[string][2]int64{
+	"int8":   {math.MinInt8, math.MaxInt8},
+	"uint8":  {0, math.MaxUint8},
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"uint16": {0, math.MaxUint16},
+	"int32":  {math.MinInt32, math.MaxInt32},
+	"uint32": {0, math.MaxUint32},
+}
+
+func jsonSchemaRef(name string) jsonSchema {
+	return jsonSchema{"$ref": "#/definitions/" + name}
+}
+
+// jsonSchemaElement returns the schema of a single value of f
+func jsonSchemaElement(p *Protocol, f Field) jsonSchema {
+	if f.EnumRef != nil {
+		return jsonSchemaRef(f.EnumRef.Name)
+	}
+	t := f.Type
+	if m, ok := goTypesMap[t]; ok {
+		t = m
+	}
+	if r, ok := jsonSchemaRanges[t]; ok {
+		return jsonSchema{"type": "integer", "minimum": r[0], "maximum": r[1]}
+	}
+	switch t {
+	case "int64":
+		return jsonSchema{"type": "integer"}
+	case "uint64":
+		return jsonSchema{"type": "integer", "minimum": 0}
+	case "float32", "float64":
+		return jsonSchema{"type": "number"}
+	case "string":
+		return jsonSchema{"type": "string"}
+	case "bool":
+		return jsonSchema{"type": "boolean"}
+	}
+	if !f.UseTypeManager {
+		return jsonSchemaRef(t)
+	}
+	subtypes := p.subtypes(t)
+	if len(subtypes) == 0 {
+		return jsonSchemaRef(t)
+	}
+	anyOf := []jsonSchema{jsonSchemaRef(t)}
+	for _, s := range subtypes {
+		anyOf = append(anyOf, jsonSchemaRef(s))
+	}
+	return jsonSchema{"anyOf": anyOf}
+}
+
+func jsonSchemaField(p *Protocol, f Field) jsonSchema {
+	if f.IsByteArray {
+		// encoding/json writes byte slices as base64 strings
+		return jsonSchema{"type": "string", "contentEncoding": "base64"}
+	}
+	s := jsonSchemaElement(p, f)
+	for i := f.Dimensions(); i > 0; i-- {
+		s = jsonSchema{"type": "array", "items": s}
+	}
+	if f.IsFixedLength && f.Dimensions() > 0 {
+		s["minItems"] = f.Length
+		s["maxItems"] = f.Length
+	}
+	return s
+}
+
+func jsonSchemaClass(p *Protocol, c Class) (jsonSchema, error) {
+	fields, err := p.ResolveFields(c)
+	if err != nil {
+		return nil, err
+	}
+	properties := jsonSchema{}
+	required := []string{}
+	for _, f := range fields {
+		properties[f.Name] = jsonSchemaField(p, f)
+		required = append(required, f.Name)
+	}
+	return jsonSchema{
+		"title":                c.Name,
+		"description":          fmt.Sprintf("%v has the protocol id %v", c.Name, c.ProtocolID),
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}, nil
+}
+
+func jsonSchemaEnum(e Enum) jsonSchema {
+	var values []int64
+	seen := map[int32]bool{}
+	for _, v := range e.Values {
+		if seen[v.Value] {
+			continue
+		}
+		seen[v.Value] = true
+		// the values of a uint enumeration are not reinterpreted as signed
+		if e.Underlying == "uint" {
+			values = append(values, int64(uint32(v.Value)))
+		} else {
+			values = append(values, int64(v.Value))
+		}
+	}
+	return jsonSchema{"title": e.Name, "type": "integer", "enum": values}
+}
+
+// GenerateJSONSchema writes a JSON Schema document describing the protocol to
+// w. Every enumeration, type and message is a definition, messages and types
+// are objects whose properties are their fields, inherited fields included.
+// The protocol must be linked for the enumerations to be referenced.
+func GenerateJSONSchema(p *Protocol, w io.Writer) error {
+	definitions := jsonSchema{}
+	for _, e := range p.Enums {
+		definitions[e.Name] = jsonSchemaEnum(e)
+	}
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			s, err := jsonSchemaClass(p, c)
+			if err != nil {
+				return newError(err, "json schema generation failed")
+			}
+			definitions[c.Name] = s
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonSchema{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"definitions": definitions,
+	})
+}
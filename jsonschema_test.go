@@ -0,0 +1,121 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateJSONSchema(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{
+				Name:       "IdentificationSuccessMessage",
+				ProtocolID: 22,
+				Fields: []Field{
+					{Name: "login", Type: "string"},
+					{Name: "alignmentSide", Type: "AlignmentSideEnum"},
+				},
+			},
+			{
+				Name:       "IdentificationSuccessWithLoginTokenMessage",
+				Parent:     "IdentificationSuccessMessage",
+				ProtocolID: 6209,
+				Fields: []Field{
+					{Name: "loginToken", Type: "string"},
+				},
+			},
+		},
+		Types: []Class{
+			{Name: "EntityLook", ProtocolID: 55, Fields: []Field{
+				{Name: "bonesId", Type: "uint16"},
+				{Name: "scales", Type: "int16", IsVector: true, VectorDepth: 1, IsFixedLength: true, Length: 2},
+			}},
+			{Name: "GameContextActorInformations", ProtocolID: 150, Fields: []Field{
+				{Name: "contextualId", Type: "float64"},
+				{Name: "look", Type: "EntityLook"},
+			}},
+			{Name: "GameRolePlayActorInformations", Parent: "GameContextActorInformations", ProtocolID: 141},
+			{Name: "RawData", ProtocolID: 1, Fields: []Field{
+				{Name: "content", Type: "uint8", IsVector: true, VectorDepth: 1, IsByteArray: true},
+				{Name: "actors", Type: "GameContextActorInformations", IsVector: true, VectorDepth: 1, UseTypeManager: true},
+			}},
+		},
+		Enums: []Enum{
+			{"AlignmentSideEnum", []EnumValue{{"ALIGNMENT_UNKNOWN", -2}, {"ALIGNMENT_NEUTRAL", 0}, {"ALIGNMENT_DEFAULT", 0}}, "int", false, "int8"},
+			{"GuildRightsEnum", []EnumValue{{"RIGHT_MANAGE_RANKS", 1}, {"RIGHT_BOSS", -2147483648}}, "uint", true, "uint32"},
+		},
+	}
+	p.Link()
+
+	var buf bytes.Buffer
+	if err := GenerateJSONSchema(p, &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	var schema struct {
+		Definitions map[string]json.RawMessage `json:"definitions"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		definition string
+		want       string
+	}{
+		{
+			"enum",
+			"AlignmentSideEnum",
+			`{"enum":[-2,0],"title":"AlignmentSideEnum","type":"integer"}`,
+		},
+		{
+			"uint enum",
+			"GuildRightsEnum",
+			`{"enum":[1,2147483648],"title":"GuildRightsEnum","type":"integer"}`,
+		},
+		{
+			"inherited fields",
+			"IdentificationSuccessWithLoginTokenMessage",
+			`{"additionalProperties":false,"description":"IdentificationSuccessWithLoginTokenMessage has the protocol id 6209",` +
+				`"properties":{"alignmentSide":{"$ref":"#/definitions/AlignmentSideEnum"},"login":{"type":"string"},"loginToken":{"type":"string"}},` +
+				`"required":["login","alignmentSide","loginToken"],"title":"IdentificationSuccessWithLoginTokenMessage","type":"object"}`,
+		},
+		{
+			"fixed vector",
+			"EntityLook",
+			`{"additionalProperties":false,"description":"EntityLook has the protocol id 55",` +
+				`"properties":{"bonesId":{"maximum":65535,"minimum":0,"type":"integer"},` +
+				`"scales":{"items":{"maximum":32767,"minimum":-32768,"type":"integer"},"maxItems":2,"minItems":2,"type":"array"}},` +
+				`"required":["bonesId","scales"],"title":"EntityLook","type":"object"}`,
+		},
+		{
+			"byte array and type manager",
+			"RawData",
+			`{"additionalProperties":false,"description":"RawData has the protocol id 1",` +
+				`"properties":{"actors":{"items":{"anyOf":[{"$ref":"#/definitions/GameContextActorInformations"},{"$ref":"#/definitions/GameRolePlayActorInformations"}]},"type":"array"},` +
+				`"content":{"contentEncoding":"base64","type":"string"}},` +
+				`"required":["content","actors"],"title":"RawData","type":"object"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, want interface{}
+			if err := json.Unmarshal(schema.Definitions[tt.definition], &got); err != nil {
+				t.Fatalf("expected %v to be defined, got %v", tt.definition, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", tt.want, string(schema.Definitions[tt.definition]))
+			}
+		})
+	}
+
+	p.Messages[1].Parent = "MissingMessage"
+	if err := GenerateJSONSchema(p, &buf); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
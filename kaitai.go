@@ -0,0 +1,245 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// kaitaiTypesMap maps the writer methods to Kaitai Struct types
+var kaitaiTypesMap = map[string]string{
+	"Int8":    "s1",
+	"UInt8":   "u1",
+	"Int16":   "s2",
+	"UInt16":  "u2",
+	"Int32":   "s4",
+	"UInt32":  "u4",
+	"Int64":   "s8",
+	"UInt64":  "u8",
+	"Float":   "f4",
+	"Double":  "f8",
+	"Boolean": "u1",
+	"String":  "utf",
+}
+
+// kaitaiVarType is the type of the var-length integers. They are read as
+// unsigned, signed values must be reinterpreted by the user.
+const kaitaiVarType = "vlq_base128_le"
+
+func kaitaiMethodType(method string) (string, bool) {
+	if strings.HasPrefix(method, "Var") {
+		return kaitaiVarType, true
+	}
+	t, ok := kaitaiTypesMap[method]
+	return t, ok
+}
+
+// kaitaiName converts a name like failedAttempts or KrosmasterFigure to
+// failed_attempts or krosmaster_figure
+func kaitaiName(name string) string {
+	var buf strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			buf.WriteRune('_')
+		}
+		buf.WriteRune(unicode.ToLower(r))
+	}
+	return buf.String()
+}
+
+// kaitaiSubtypes returns the types of p that are name or inherit from it
+func kaitaiSubtypes(p *Protocol, name string) []Class {
+	var subtypes []Class
+	for _, c := range p.Types {
+		visited := map[string]bool{}
+		for cur, ok := c, true; ok && !visited[cur.Name]; cur, ok = p.classByName(cur.Parent) {
+			if cur.Name == name {
+				subtypes = append(subtypes, c)
+				break
+			}
+			visited[cur.Name] = true
+		}
+	}
+	return subtypes
+}
+
+func writeKaitaiBox(buf *bytes.Buffer, box []Field) {
+	var bit uint
+	for _, f := range box {
+		if f.BBWBit() > bit {
+			fmt.Fprintf(buf, "      - type: b%v\n", f.BBWBit()-bit)
+		}
+		fmt.Fprintf(buf, "      - id: %v\n        type: b1\n", kaitaiName(f.Name))
+		bit = f.BBWBit() + 1
+	}
+	if bit < 8 {
+		fmt.Fprintf(buf, "      - type: b%v\n", 8-bit)
+	}
+}
+
+// kaitaiCondition returns the if key of a field only written when its
+// presence flag is set, the flag being a bit of a box or a writeBoolean byte
+func kaitaiCondition(c Class, f Field) string {
+	if f.PresenceFlag == "" {
+		return ""
+	}
+	flag := kaitaiName(f.PresenceFlag)
+	for _, candidate := range c.Fields {
+		if candidate.Name == f.PresenceFlag && candidate.UseBBW {
+			return fmt.Sprintf("        if: %v\n", flag)
+		}
+	}
+	return fmt.Sprintf("        if: %v != 0\n", flag)
+}
+
+func writeKaitaiField(buf *bytes.Buffer, c Class, f Field, polymorphic map[string]kaitaiPolymorphic) error {
+	id := kaitaiName(f.Name)
+	if f.Dimensions() > 1 {
+		return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNestedVector)
+	}
+	cond := kaitaiCondition(c, f)
+
+	var repeat string
+	if f.IsVector {
+		switch {
+		case f.IsDynamicLength:
+			method, _ := lengthMethod(f)
+			t, ok := kaitaiMethodType(method)
+			if !ok {
+				return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNoMethod)
+			}
+			fmt.Fprintf(buf, "      - id: %v_len\n        type: %v\n%v", id, t, cond)
+			repeat = id + "_len"
+			if t == kaitaiVarType {
+				repeat += ".value"
+			}
+		default:
+			repeat = fmt.Sprint(f.Length)
+		}
+	}
+
+	if f.IsByteArray {
+		fmt.Fprintf(buf, "      - id: %v\n        size: %v\n%v", id, repeat, cond)
+		return nil
+	}
+
+	fmt.Fprintf(buf, "      - id: %v\n", id)
+	switch {
+	case f.Method != "":
+		t, ok := kaitaiMethodType(f.Method)
+		if !ok {
+			return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNoMethod)
+		}
+		fmt.Fprintf(buf, "        type: %v\n", t)
+	case f.IsScalar():
+		return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNoMethod)
+	case f.UseTypeManager:
+		// the type id is written before each value, vectors included
+		any := kaitaiPolymorphic{f.Type, "u2"}
+		if f.TypeIDWriteMethod == "writeVarShort" {
+			any.idType = kaitaiVarType
+		}
+		polymorphic[any.id()] = any
+		fmt.Fprintf(buf, "        type: %v\n", any.id())
+	default:
+		fmt.Fprintf(buf, "        type: %v\n", kaitaiName(f.Type))
+	}
+	if repeat != "" {
+		fmt.Fprintf(buf, "        repeat: expr\n        repeat-expr: %v\n", repeat)
+	}
+	buf.WriteString(cond)
+	return nil
+}
+
+// kaitaiPolymorphic is a value written with its type id, which can be the
+// type name or any type inheriting from it
+type kaitaiPolymorphic struct {
+	name   string
+	idType string // idType is the Kaitai type of the type id, see Field.TypeIDWriteMethod
+}
+
+// id returns the name of the Kaitai type, the one of a var-length type id
+// differs so that both can be used in the same protocol
+func (k kaitaiPolymorphic) id() string {
+	if k.idType == kaitaiVarType {
+		return kaitaiName(k.name) + "_var_any"
+	}
+	return kaitaiName(k.name) + "_any"
+}
+
+// writeKaitaiPolymorphic writes the type of a value written with its type id
+func writeKaitaiPolymorphic(buf *bytes.Buffer, p *Protocol, k kaitaiPolymorphic) {
+	fmt.Fprintf(buf, "  %v:\n    seq:\n      - id: type_id\n        type: %v\n      - id: value\n", k.id(), k.idType)
+	subtypes := kaitaiSubtypes(p, k.name)
+	if len(subtypes) == 0 {
+		fmt.Fprintf(buf, "        type: %v\n", kaitaiName(k.name))
+		return
+	}
+	switchOn := "type_id"
+	if k.idType == kaitaiVarType {
+		switchOn += ".value"
+	}
+	fmt.Fprintf(buf, "        type:\n          switch-on: %v\n          cases:\n", switchOn)
+	for _, sub := range subtypes {
+		fmt.Fprintf(buf, "            %v: %v\n", sub.ProtocolID, kaitaiName(sub.Name))
+	}
+}
+
+func writeKaitaiType(buf *bytes.Buffer, c Class, polymorphic map[string]kaitaiPolymorphic) error {
+	fmt.Fprintf(buf, "  %v:\n", kaitaiName(c.Name))
+	fmt.Fprintf(buf, "    doc: %v.%v, protocol id %v\n", c.Namespace, c.Name, c.ProtocolID)
+	if c.Parent == "" && len(c.Fields) == 0 {
+		return nil
+	}
+	buf.WriteString("    seq:\n")
+	if c.Parent != "" {
+		fmt.Fprintf(buf, "      - id: base\n        type: %v\n", kaitaiName(c.Parent))
+	}
+	for _, item := range serializerItems(c.Fields) {
+		if item.box != nil {
+			writeKaitaiBox(buf, item.box)
+			continue
+		}
+		if err := writeKaitaiField(buf, c, item.field, polymorphic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateKaitai writes a Kaitai Struct definition of the wire format of every
+// type and message of the protocol to w. Parents are read first as a base
+// field and fields using the type manager switch on the type id that
+// precedes each of their values. The fields guarded by a presence flag are
+// only read when it is set. Var-length integers use the vlq_base128_le type
+// of the Kaitai Struct formats library.
+func GenerateKaitai(p *Protocol, w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Code generated by d2protocolparser. DO NOT EDIT.\n")
+	buf.WriteString("meta:\n  id: dofus_protocol\n  endian: be\n  bit-endian: le\n")
+	fmt.Fprintf(&buf, "  imports:\n    - /common/%v\n", kaitaiVarType)
+	buf.WriteString("types:\n")
+	buf.WriteString("  utf:\n    seq:\n      - id: len\n        type: u2\n")
+	buf.WriteString("      - id: value\n        type: str\n        size: len\n        encoding: UTF-8\n")
+	polymorphic := map[string]kaitaiPolymorphic{}
+	var names []string
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			if err := writeKaitaiType(&buf, c, polymorphic); err != nil {
+				return newError(err, "kaitai generation failed")
+			}
+		}
+	}
+	for name := range polymorphic {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeKaitaiPolymorphic(&buf, p, polymorphic[name])
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,42 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGenerateKaitai(t *testing.T) {
+	expected, err := ioutil.ReadFile("./fixtures/protocol.ksy.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := goldenProtocol()
+	p.Types = append(p.Types,
+		Class{Name: "EntityDispositionInformations", Namespace: "com.ankamagames.dofus.network.types.game.context", ProtocolID: 60, Fields: []Field{
+			{Name: "cellId", Type: "int16", WriteMethod: "writeShort", Method: "Int16"},
+		}},
+		Class{Name: "IdentifiedEntityDispositionInformations", Namespace: "com.ankamagames.dofus.network.types.game.context", Parent: "EntityDispositionInformations", ProtocolID: 107, Fields: []Field{
+			{Name: "id", Type: "float64", WriteMethod: "writeDouble", Method: "Double"},
+		}},
+	)
+	p.Messages = append(p.Messages, Class{Name: "RawDataMessage", Namespace: "com.ankamagames.dofus.network.messages.security", ProtocolID: 6253, Fields: []Field{
+		{Name: "content", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarInt", IsByteArray: true},
+	}}, Class{Name: "GameRolePlayShowActorMessage", Namespace: "com.ankamagames.dofus.network.messages.game.context.roleplay", ProtocolID: 5632, Fields: []Field{
+		{Name: "hasLook", Type: "bool", WriteMethod: "writeBoolean", Method: "Boolean"},
+		{Name: "look", Type: "EntityLook", PresenceFlag: "hasLook", Optional: true},
+		{Name: "cells", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort", PresenceFlag: "hasLook", Optional: true},
+		{Name: "visible", Type: "bool", UseBBW: true},
+		{Name: "name", Type: "string", WriteMethod: "writeUTF", Method: "String", PresenceFlag: "visible", Optional: true},
+		{Name: "disposition", Type: "EntityDispositionInformations", UseTypeManager: true, TypeIDWriteMethod: "writeVarShort"},
+	}})
+
+	var buf bytes.Buffer
+	if err = GenerateKaitai(p, &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), buf.String())
+	}
+}
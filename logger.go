@@ -0,0 +1,15 @@
+package d2protocolparser
+
+// Logger receives the diagnostics of the extraction. It must be safe for
+// concurrent use since classes are extracted concurrently, a *log.Logger is
+// a valid Logger.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// logf writes a diagnostic line to the logger of the build options, if any
+func (b *Builder) logf(format string, args ...interface{}) {
+	if b.opts.Logger != nil {
+		b.opts.Logger.Printf(format, args...)
+	}
+}
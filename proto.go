@@ -0,0 +1,132 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrGenerateNestedVector means that a field is a vector of vectors, which
+// has no equivalent in the target language
+var ErrGenerateNestedVector = errors.New("nested vectors are not supported")
+
+// protoTypesMap maps the reduced Go types to Protocol Buffers scalar types
+var protoTypesMap = map[string]string{
+	"int8":    "int32",
+	"int16":   "int32",
+	"int32":   "int32",
+	"uint8":   "uint32",
+	"uint16":  "uint32",
+	"uint32":  "uint32",
+	"int64":   "int64",
+	"uint64":  "uint64",
+	"float32": "float",
+	"float64": "double",
+	"string":  "string",
+	"bool":    "bool",
+}
+
+func protoType(f Field) string {
+	if f.IsByteArray {
+		return "bytes"
+	}
+	if f.EnumRef != nil {
+		return f.EnumRef.Name
+	}
+	t := f.Type
+	if m, ok := goTypesMap[t]; ok {
+		t = m
+	}
+	if m, ok := protoTypesMap[t]; ok {
+		t = m
+	}
+	if f.IsVector {
+		t = "repeated " + t
+	}
+	return t
+}
+
+// protoEnumPrefix converts an enumeration name like AlignmentSideEnum to
+// ALIGNMENT_SIDE_ENUM_, enumeration values share the package scope in
+// Protocol Buffers and are prefixed to avoid conflicts
+func protoEnumPrefix(name string) string {
+	var buf strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			buf.WriteRune('_')
+		}
+		buf.WriteRune(unicode.ToUpper(r))
+	}
+	buf.WriteRune('_')
+	return buf.String()
+}
+
+func writeProtoEnum(buf *bytes.Buffer, e Enum) {
+	prefix := protoEnumPrefix(e.Name)
+	fmt.Fprintf(buf, "enum %v {\n", e.Name)
+	if len(e.DuplicateValues()) > 0 {
+		buf.WriteString("  option allow_alias = true;\n")
+	}
+	// the first value of an enumeration must be 0
+	var zeros, others []EnumValue
+	for _, v := range e.Values {
+		if v.Value == 0 {
+			zeros = append(zeros, v)
+		} else {
+			others = append(others, v)
+		}
+	}
+	if len(zeros) == 0 {
+		zeros = []EnumValue{{"UNSPECIFIED", 0}}
+	}
+	for _, v := range append(zeros, others...) {
+		fmt.Fprintf(buf, "  %v%v = %v;\n", prefix, v.Name, v.Value)
+	}
+	buf.WriteString("}\n\n")
+}
+
+func writeProtoMessage(buf *bytes.Buffer, p *Protocol, c Class) error {
+	fields, err := p.ResolveFields(c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "// %v has the protocol id %v\n", c.Name, c.ProtocolID)
+	fmt.Fprintf(buf, "message %v {\n", c.Name)
+	for i, f := range fields {
+		if f.Dimensions() > 1 {
+			return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNestedVector)
+		}
+		fmt.Fprintf(buf, "  %v %v = %v;\n", protoType(f), f.Name, i+1)
+	}
+	buf.WriteString("}\n\n")
+	return nil
+}
+
+// GenerateProto writes a Protocol Buffers schema of the protocol to w, in the
+// package pkg. Every type and message becomes a message whose fields are
+// numbered in wire order, inherited fields included.
+//
+// The schema is only structurally equivalent to the protocol, messages
+// encoded with it are not compatible with the Dofus wire format.
+func GenerateProto(p *Protocol, w io.Writer, pkg string) error {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by d2protocolparser. DO NOT EDIT.\n\n")
+	buf.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&buf, "package %v;\n\n", pkg)
+	for _, e := range p.Enums {
+		writeProtoEnum(&buf, e)
+	}
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			if err := writeProtoMessage(&buf, p, c); err != nil {
+				return newError(err, "proto generation failed")
+			}
+		}
+	}
+	buf.Truncate(buf.Len() - 1)
+	_, err := buf.WriteTo(w)
+	return err
+}
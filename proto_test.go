@@ -0,0 +1,107 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGenerateProto(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{
+				Name:       "IdentificationSuccessMessage",
+				ProtocolID: 22,
+				Fields: []Field{
+					{Name: "login", Type: "string"},
+					{Name: "alignmentSide", Type: "AlignmentSideEnum"},
+				},
+			},
+			{
+				Name:       "IdentificationSuccessWithLoginTokenMessage",
+				Parent:     "IdentificationSuccessMessage",
+				ProtocolID: 6209,
+				Fields: []Field{
+					{Name: "loginToken", Type: "string"},
+				},
+			},
+		},
+		Types: []Class{
+			{
+				Name:       "KrosmasterFigure",
+				ProtocolID: 397,
+				Fields: []Field{
+					{Name: "figure", Type: "uint16"},
+					{Name: "bound", Type: "bool"},
+					{Name: "looks", Type: "EntityLook", IsVector: true},
+					{Name: "content", Type: "uint8", IsVector: true, IsByteArray: true},
+				},
+			},
+		},
+		Enums: []Enum{
+			{"AlignmentSideEnum", []EnumValue{{"ALIGNMENT_UNKNOWN", -2}, {"ALIGNMENT_NEUTRAL", 0}, {"ALIGNMENT_DEFAULT", 0}}, "int", false, "int8"},
+			{"PresetSaveResultEnum", []EnumValue{{"PRESET_SAVE_OK", 1}, {"PRESET_SAVE_ERR_UNKNOWN", 2}}, "uint", false, "uint8"},
+		},
+	}
+	p.Link()
+
+	expected := `// Code generated by d2protocolparser. DO NOT EDIT.
+
+syntax = "proto3";
+
+package dofus;
+
+enum AlignmentSideEnum {
+  option allow_alias = true;
+  ALIGNMENT_SIDE_ENUM_ALIGNMENT_NEUTRAL = 0;
+  ALIGNMENT_SIDE_ENUM_ALIGNMENT_DEFAULT = 0;
+  ALIGNMENT_SIDE_ENUM_ALIGNMENT_UNKNOWN = -2;
+}
+
+enum PresetSaveResultEnum {
+  PRESET_SAVE_RESULT_ENUM_UNSPECIFIED = 0;
+  PRESET_SAVE_RESULT_ENUM_PRESET_SAVE_OK = 1;
+  PRESET_SAVE_RESULT_ENUM_PRESET_SAVE_ERR_UNKNOWN = 2;
+}
+
+// KrosmasterFigure has the protocol id 397
+message KrosmasterFigure {
+  uint32 figure = 1;
+  bool bound = 2;
+  repeated EntityLook looks = 3;
+  bytes content = 4;
+}
+
+// IdentificationSuccessMessage has the protocol id 22
+message IdentificationSuccessMessage {
+  string login = 1;
+  AlignmentSideEnum alignmentSide = 2;
+}
+
+// IdentificationSuccessWithLoginTokenMessage has the protocol id 6209
+message IdentificationSuccessWithLoginTokenMessage {
+  string login = 1;
+  AlignmentSideEnum alignmentSide = 2;
+  string loginToken = 3;
+}
+`
+	var buf bytes.Buffer
+	if err := GenerateProto(p, &buf, "dofus"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected %v, got %v", expected, buf.String())
+	}
+}
+
+func TestGenerateProto_NestedVector(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "MapCoordinates", Fields: []Field{{Name: "cells", Type: "uint16", IsVector: true, VectorDepth: 2}}},
+		},
+	}
+	if err := GenerateProto(p, ioutil.Discard, "dofus"); !errors.Is(err, ErrGenerateNestedVector) {
+		t.Errorf("expected %v, got %v", ErrGenerateNestedVector, err)
+	}
+}
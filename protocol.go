@@ -0,0 +1,381 @@
+package d2protocolparser
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrResolveUnknownParent means that the parent of a class could not be found
+// in the protocol
+var ErrResolveUnknownParent = errors.New("unknown parent")
+
+// ErrResolveCycle means that the parent chain of a class loops on itself
+var ErrResolveCycle = errors.New("inheritance cycle")
+
+// ErrResolveUnknownClass means that the first segment of a field path is not
+// a message or a type of the protocol
+var ErrResolveUnknownClass = errors.New("unknown class")
+
+// ErrResolveUnknownField means that a segment of a field path is not a field
+// of the class it is looked up in
+var ErrResolveUnknownField = errors.New("unknown field")
+
+// ErrResolveNotType means that a field path descends into a field whose type
+// is not a type of the protocol
+var ErrResolveNotType = errors.New("field is not a protocol type")
+
+// fieldPathError tells which segment of a field path failed to resolve
+type fieldPathError struct {
+	err     error
+	path    string
+	segment string
+}
+
+func (e fieldPathError) Error() string {
+	return fmt.Sprintf("%v at %v : %v", e.path, e.segment, e.err)
+}
+
+func (e fieldPathError) Unwrap() error {
+	return e.err
+}
+
+type resolveError struct {
+	err    error
+	class  string
+	parent string
+}
+
+func (e resolveError) Error() string {
+	return fmt.Sprintf("%v:%v : %v", e.class, e.parent, e.err)
+}
+
+func (e resolveError) Unwrap() error {
+	return e.err
+}
+
+// protocolIndex maps the ids and the names of the classes of a protocol to
+// their position. It is built by the first lookup, the protocol must not be
+// modified afterwards.
+type protocolIndex struct {
+	once         sync.Once
+	messageIDs   map[uint16]int
+	messageNames map[string]int
+	typeNames    map[string]int
+}
+
+// lookupIndex returns the index of p, or nil when p was not built by this
+// package and its classes have to be searched one by one
+func (p *Protocol) lookupIndex() *protocolIndex {
+	if p.index == nil {
+		return nil
+	}
+	p.index.once.Do(func() {
+		idx := p.index
+		idx.messageIDs = make(map[uint16]int, len(p.Messages))
+		idx.messageNames = make(map[string]int, len(p.Messages))
+		idx.typeNames = make(map[string]int, len(p.Types))
+		// the first class wins like with a linear search
+		for i := len(p.Messages) - 1; i >= 0; i-- {
+			if !p.Messages[i].Abstract {
+				idx.messageIDs[p.Messages[i].ProtocolID] = i
+			}
+			idx.messageNames[p.Messages[i].Name] = i
+		}
+		for i := len(p.Types) - 1; i >= 0; i-- {
+			idx.typeNames[p.Types[i].Name] = i
+		}
+	})
+	return p.index
+}
+
+// MessageByID returns the message with the given protocol id, abstract
+// messages have no id and are never returned
+func (p *Protocol) MessageByID(id uint16) (Class, bool) {
+	if idx := p.lookupIndex(); idx != nil {
+		i, ok := idx.messageIDs[id]
+		if !ok {
+			return Class{}, false
+		}
+		return p.Messages[i], true
+	}
+	for _, c := range p.Messages {
+		if c.ProtocolID == id && !c.Abstract {
+			return c, true
+		}
+	}
+	return Class{}, false
+}
+
+// MessageIDs returns the protocol ids of the messages in ascending order,
+// abstract messages have no id and are left out
+func (p *Protocol) MessageIDs() []uint16 {
+	seen := map[uint16]bool{}
+	ids := []uint16{}
+	for _, c := range p.Messages {
+		if c.Abstract || seen[c.ProtocolID] {
+			continue
+		}
+		seen[c.ProtocolID] = true
+		ids = append(ids, c.ProtocolID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// HasMessageID reports whether a message has the given protocol id
+func (p *Protocol) HasMessageID(id uint16) bool {
+	_, ok := p.MessageByID(id)
+	return ok
+}
+
+// MessageByName returns the message with the given name
+func (p *Protocol) MessageByName(name string) (Class, bool) {
+	if idx := p.lookupIndex(); idx != nil {
+		i, ok := idx.messageNames[name]
+		if !ok {
+			return Class{}, false
+		}
+		return p.Messages[i], true
+	}
+	for _, c := range p.Messages {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Class{}, false
+}
+
+// TypeByName returns the type with the given name
+func (p *Protocol) TypeByName(name string) (Class, bool) {
+	if idx := p.lookupIndex(); idx != nil {
+		i, ok := idx.typeNames[name]
+		if !ok {
+			return Class{}, false
+		}
+		return p.Types[i], true
+	}
+	for _, c := range p.Types {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Class{}, false
+}
+
+func (p *Protocol) classByName(name string) (Class, bool) {
+	if c, ok := p.MessageByName(name); ok {
+		return c, true
+	}
+	return p.TypeByName(name)
+}
+
+// ancestors returns the parents of c from its immediate parent up to the root
+func (p *Protocol) ancestors(c Class) ([]Class, error) {
+	var chain []Class
+	visited := map[string]bool{c.Name: true}
+	for cur := c; cur.Parent != ""; {
+		parent, ok := p.classByName(cur.Parent)
+		if !ok {
+			return nil, resolveError{ErrResolveUnknownParent, cur.Name, cur.Parent}
+		}
+		if visited[parent.Name] {
+			return nil, resolveError{ErrResolveCycle, cur.Name, cur.Parent}
+		}
+		visited[parent.Name] = true
+		chain = append(chain, parent)
+		cur = parent
+	}
+	return chain, nil
+}
+
+// Ancestry returns the names of the parents of c, from its immediate parent
+// up to the root. It fails with ErrResolveCycle if the chain loops on itself
+// and with ErrResolveUnknownParent if a parent is not part of the protocol.
+func (p *Protocol) Ancestry(c Class) ([]string, error) {
+	chain, err := p.ancestors(c)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, parent := range chain {
+		names = append(names, parent.Name)
+	}
+	return names, nil
+}
+
+// subtypes returns the types of p that inherit from name, a field written
+// with the type manager may hold any of them
+func (p *Protocol) subtypes(name string) []string {
+	var subtypes []string
+	for _, t := range p.Types {
+		// broken chains are reported by the class that has them
+		ancestry, _ := p.Ancestry(t)
+		for _, parent := range ancestry {
+			if parent == name {
+				subtypes = append(subtypes, t.Name)
+				break
+			}
+		}
+	}
+	return subtypes
+}
+
+// ResolveFields returns every field of c including the inherited ones,
+// starting from the root class down to c. The Order of the fields is their
+// index in the flattened wire layout.
+func (p *Protocol) ResolveFields(c Class) ([]Field, error) {
+	chain, err := p.ancestors(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []Field
+	for i := len(chain) - 1; i >= 0; i-- {
+		fields = appendOrdered(fields, chain[i].Fields)
+	}
+	return appendOrdered(fields, c.Fields), nil
+}
+
+// appendOrdered appends the fields of a class after the fields of its
+// parents, their Order is shifted to follow the inherited ones
+func appendOrdered(fields []Field, own []Field) []Field {
+	offset := len(fields)
+	for _, f := range own {
+		f.Order += offset
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// AllFields returns the inherited fields of c followed by its own fields, in
+// wire order. It fails if a parent can not be found in the protocol.
+func (p *Protocol) AllFields(c *Class) ([]Field, error) {
+	return p.ResolveFields(*c)
+}
+
+// FindFieldPath resolves a dotted path like
+// CharacterBaseInformations.entityLook.bonesId. The first segment is a message
+// or a type, the next ones are fields, inherited ones included, each field
+// but the last one being of a protocol type. It returns the last field and
+// the class it was found in, or an error naming the segment that failed.
+func (p *Protocol) FindFieldPath(path string) (Class, Field, error) {
+	segments := strings.Split(path, ".")
+	c, ok := p.classByName(segments[0])
+	if !ok {
+		return Class{}, Field{}, fieldPathError{ErrResolveUnknownClass, path, segments[0]}
+	}
+	if len(segments) == 1 {
+		return Class{}, Field{}, fieldPathError{ErrResolveUnknownField, path, segments[0]}
+	}
+
+	var f Field
+	for i, name := range segments[1:] {
+		if i > 0 {
+			// segments[i] is the field resolved by the previous iteration
+			next, ok := p.TypeByName(f.Type)
+			if !ok {
+				return Class{}, Field{}, fieldPathError{ErrResolveNotType, path, segments[i]}
+			}
+			c = next
+		}
+		fields, err := p.ResolveFields(c)
+		if err != nil {
+			return Class{}, Field{}, fieldPathError{err, path, segments[i]}
+		}
+		found := false
+		for _, candidate := range fields {
+			if candidate.Name == name {
+				f, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return Class{}, Field{}, fieldPathError{ErrResolveUnknownField, path, name}
+		}
+	}
+	return c, f, nil
+}
+
+// Link sets the TypeRef and EnumRef of every field whose type is a type or an
+// enumeration of the protocol. Fields of scalar types are left untouched.
+func (p *Protocol) Link() {
+	types := map[string]*Class{}
+	for i := range p.Types {
+		types[p.Types[i].Name] = &p.Types[i]
+	}
+	enums := map[string]*Enum{}
+	for i := range p.Enums {
+		enums[p.Enums[i].Name] = &p.Enums[i]
+	}
+
+	link := func(classes []Class) {
+		for i := range classes {
+			for j := range classes[i].Fields {
+				f := &classes[i].Fields[j]
+				f.TypeRef = types[f.Type]
+				f.EnumRef = enums[f.Type]
+			}
+		}
+	}
+	link(p.Messages)
+	link(p.Types)
+}
+
+// UnreferencedTypes returns the names of the types that no message uses, in
+// the order of p.Types. Starting from the messages, a class uses its parent
+// and the types of its fields, along with every subtype of the types written
+// with the type manager.
+func (p *Protocol) UnreferencedTypes() []string {
+	subtypes := map[string][]string{}
+	for _, t := range p.Types {
+		// broken chains are reported by the verifier
+		ancestry, _ := p.Ancestry(t)
+		for _, parent := range ancestry {
+			subtypes[parent] = append(subtypes[parent], t.Name)
+		}
+	}
+
+	reached := map[string]bool{}
+	var queue []Class
+	reach := func(name string) {
+		if reached[name] {
+			return
+		}
+		reached[name] = true
+		if c, ok := p.classByName(name); ok {
+			queue = append(queue, c)
+		}
+	}
+	for _, m := range p.Messages {
+		reach(m.Name)
+	}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if c.Parent != "" {
+			reach(c.Parent)
+		}
+		for _, f := range c.Fields {
+			if isScalarType(f) {
+				continue
+			}
+			reach(f.Type)
+			if f.UseTypeManager {
+				for _, s := range subtypes[f.Type] {
+					reach(s)
+				}
+			}
+		}
+	}
+
+	var names []string
+	for _, t := range p.Types {
+		if !reached[t.Name] {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,297 @@
+package d2protocolparser
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProtocol_ResolveFields(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "IdentificationSuccessMessage", Fields: []Field{{Name: "login"}, {Name: "nickname", Order: 1}}},
+			{Name: "IdentificationSuccessWithLoginTokenMessage", Parent: "IdentificationSuccessMessage", Fields: []Field{{Name: "loginToken"}}},
+			{Name: "Orphan", Parent: "Unknown"},
+			{Name: "CycleA", Parent: "CycleB"},
+			{Name: "CycleB", Parent: "CycleA"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		class   string
+		want    []Field
+		wantErr error
+	}{
+		{"root", "IdentificationSuccessMessage", []Field{{Name: "login"}, {Name: "nickname", Order: 1}}, nil},
+		{"child", "IdentificationSuccessWithLoginTokenMessage", []Field{{Name: "login"}, {Name: "nickname", Order: 1}, {Name: "loginToken", Order: 2}}, nil},
+		{"unknown parent", "Orphan", nil, ErrResolveUnknownParent},
+		{"cycle", "CycleA", nil, ErrResolveCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := p.MessageByName(tt.class)
+			got, err := p.ResolveFields(c)
+			if tt.wantErr != nil {
+				rErr, ok := err.(resolveError)
+				if !ok || rErr.err != tt.wantErr {
+					t.Errorf("Protocol.ResolveFields() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Protocol.ResolveFields() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Protocol.ResolveFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtocol_Ancestry(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "GameRolePlayShowActorMessage"},
+			{Name: "Orphan", Parent: "Unknown"},
+			{Name: "CycleA", Parent: "CycleB"},
+			{Name: "CycleB", Parent: "CycleA"},
+		},
+		Types: []Class{
+			{Name: "GameContextActorInformations"},
+			{Name: "GameRolePlayActorInformations", Parent: "GameContextActorInformations"},
+			{Name: "GameRolePlayNamedActorInformations", Parent: "GameRolePlayActorInformations"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		class   Class
+		want    []string
+		wantErr error
+	}{
+		{"root", p.Messages[0], nil, nil},
+		{"chain", p.Types[2], []string{"GameRolePlayActorInformations", "GameContextActorInformations"}, nil},
+		{"unknown parent", p.Messages[1], nil, ErrResolveUnknownParent},
+		{"cycle", p.Messages[2], nil, ErrResolveCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Ancestry(tt.class)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Protocol.Ancestry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Protocol.Ancestry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtocol_FindFieldPath(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "CharacterSelectedSuccessMessage", Fields: []Field{{Name: "infos", Type: "CharacterBaseInformations"}}},
+		},
+		Types: []Class{
+			{Name: "CharacterMinimalInformations", Fields: []Field{{Name: "name", Type: "string"}}},
+			{Name: "CharacterBaseInformations", Parent: "CharacterMinimalInformations", Fields: []Field{{Name: "entityLook", Type: "EntityLook"}}},
+			{Name: "EntityLook", Fields: []Field{{Name: "bonesId", Type: "uint16"}}},
+			{Name: "GuildInformations", Parent: "BasicGuildInformations", Fields: []Field{{Name: "guildEmblem", Type: "GuildEmblem"}}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantClass   string
+		wantField   string
+		wantErr     error
+		wantSegment string
+	}{
+		{"nested", "CharacterBaseInformations.entityLook.bonesId", "EntityLook", "bonesId", nil, ""},
+		{"message", "CharacterSelectedSuccessMessage.infos.entityLook", "CharacterBaseInformations", "entityLook", nil, ""},
+		{"inherited", "CharacterSelectedSuccessMessage.infos.name", "CharacterBaseInformations", "name", nil, ""},
+		{"unknown class", "CharacterInformations.name", "", "", ErrResolveUnknownClass, "CharacterInformations"},
+		{"no field", "EntityLook", "", "", ErrResolveUnknownField, "EntityLook"},
+		{"unknown field", "CharacterBaseInformations.look.bonesId", "", "", ErrResolveUnknownField, "look"},
+		{"scalar", "CharacterBaseInformations.entityLook.bonesId.value", "", "", ErrResolveNotType, "bonesId"},
+		{"unknown parent", "GuildInformations.guildEmblem", "", "", ErrResolveUnknownParent, "GuildInformations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f, err := p.FindFieldPath(tt.path)
+			if tt.wantErr != nil {
+				pathErr, ok := err.(fieldPathError)
+				if !ok || !errors.Is(pathErr.err, tt.wantErr) || pathErr.segment != tt.wantSegment {
+					t.Errorf("expected %v at %v, got %v", tt.wantErr, tt.wantSegment, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if c.Name != tt.wantClass || f.Name != tt.wantField {
+				t.Errorf("expected %v.%v, got %v.%v", tt.wantClass, tt.wantField, c.Name, f.Name)
+			}
+		})
+	}
+}
+
+func TestProtocol_Link(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "GameRolePlayShowActorMessage", Fields: []Field{
+				{Name: "informations", Type: "GameRolePlayActorInformations"},
+				{Name: "side", Type: "AlignmentSideEnum"},
+				{Name: "id", Type: "uint16"},
+			}},
+		},
+		Types: []Class{
+			{Name: "GameRolePlayActorInformations"},
+		},
+		Enums: []Enum{
+			{Name: "AlignmentSideEnum"},
+		},
+	}
+	p.Link()
+
+	fields := p.Messages[0].Fields
+	if fields[0].TypeRef != &p.Types[0] || fields[0].EnumRef != nil {
+		t.Errorf("expected type reference to %v, got %v", p.Types[0].Name, fields[0])
+	}
+	if fields[1].EnumRef != &p.Enums[0] || fields[1].TypeRef != nil {
+		t.Errorf("expected enum reference to %v, got %v", p.Enums[0].Name, fields[1])
+	}
+	if fields[2].TypeRef != nil || fields[2].EnumRef != nil {
+		t.Errorf("expected no reference for scalar field, got %v", fields[2])
+	}
+}
+
+func TestProtocol_UnreferencedTypes(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "GameRolePlayShowActorMessage", Fields: []Field{
+				{Name: "informations", Type: "GameRolePlayActorInformations", UseTypeManager: true},
+				{Name: "id", Type: "uint16"},
+			}},
+			{Name: "GameRolePlayShowActorWithEventMessage", Parent: "GameRolePlayShowActorMessage"},
+		},
+		Types: []Class{
+			{Name: "GameContextActorInformations", Fields: []Field{{Name: "look", Type: "EntityLook"}}},
+			{Name: "GameRolePlayActorInformations", Parent: "GameContextActorInformations"},
+			{Name: "GameRolePlayCharacterInformations", Parent: "GameRolePlayActorInformations", Fields: []Field{
+				{Name: "alignmentInfos", Type: "ActorAlignmentInformations"},
+			}},
+			{Name: "GameFightFighterInformations", Parent: "GameContextActorInformations"},
+			{Name: "EntityLook", Fields: []Field{{Name: "subentities", Type: "SubEntity", IsVector: true}}},
+			{Name: "SubEntity", Fields: []Field{{Name: "subEntityLook", Type: "EntityLook"}}},
+			{Name: "ActorAlignmentInformations"},
+			{Name: "KrosmasterFigure"},
+		},
+	}
+
+	got := p.UnreferencedTypes()
+	expected := []string{"GameFightFighterInformations", "KrosmasterFigure"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	p.Messages[0].Fields[0].UseTypeManager = false
+	got = p.UnreferencedTypes()
+	expected = []string{"GameRolePlayCharacterInformations", "GameFightFighterInformations", "ActorAlignmentInformations", "KrosmasterFigure"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestProtocol_AllFields(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "IdentificationSuccessMessage", Fields: []Field{{Name: "login"}}},
+		},
+	}
+	c := Class{Name: "IdentificationSuccessWithLoginTokenMessage", Parent: "IdentificationSuccessMessage", Fields: []Field{{Name: "loginToken"}}}
+
+	got, err := p.AllFields(&c)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := []Field{{Name: "login"}, {Name: "loginToken", Order: 1}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestProtocol_MessageIDs(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "HelloGameMessage", ProtocolID: 101},
+			{Name: "HelloConnectMessage", ProtocolID: 3},
+			{Name: "FakeHelloGameMessage", ProtocolID: 101},
+			{Name: "AbstractGameActionMessage", Abstract: true},
+		},
+	}
+
+	expected := []uint16{3, 101}
+	if got := p.MessageIDs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	tests := []struct {
+		id   uint16
+		want bool
+	}{
+		{3, true},
+		{101, true},
+		{0, false},
+		{4, false},
+	}
+	for _, tt := range tests {
+		if got := p.HasMessageID(tt.id); got != tt.want {
+			t.Errorf("HasMessageID(%v): expected %v, got %v", tt.id, tt.want, got)
+		}
+	}
+}
+
+func TestProtocol_lookupIndex(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "HelloConnectMessage", ProtocolID: 3},
+			{Name: "HelloGameMessage", ProtocolID: 101},
+			{Name: "FakeHelloGameMessage", ProtocolID: 101},
+			{Name: "AbstractGameActionMessage", Abstract: true},
+		},
+		Types: []Class{{Name: "EntityLook", ProtocolID: 55}},
+		index: &protocolIndex{},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c, ok := p.MessageByID(101); !ok || c.Name != "HelloGameMessage" {
+				t.Errorf("expected HelloGameMessage, got %v", c.Name)
+			}
+			if c, ok := p.MessageByName("HelloConnectMessage"); !ok || c.ProtocolID != 3 {
+				t.Errorf("expected HelloConnectMessage, got %v", c.Name)
+			}
+			if c, ok := p.TypeByName("EntityLook"); !ok || c.ProtocolID != 55 {
+				t.Errorf("expected EntityLook, got %v", c.Name)
+			}
+			if _, ok := p.TypeByName("HelloGameMessage"); ok {
+				t.Errorf("expected messages not to be types")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, ok := p.MessageByID(4); ok {
+		t.Errorf("expected no message with id 4")
+	}
+	if c, ok := p.MessageByID(0); ok {
+		t.Errorf("expected abstract messages to have no id, got %v", c.Name)
+	}
+}
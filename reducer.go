@@ -4,20 +4,61 @@ import (
 	"strings"
 )
 
-var writeMethodTypesMap = map[string]string{
-	"writeVarShort":    "int16",
-	"writeVarInt":      "int32",
-	"writeVarLong":     "int64",
-	"writeBoolean":     "bool",
-	"writeByte":        "int8",
-	"writeShort":       "int16",
-	"writeInt":         "int32",
-	"writeUnsignedInt": "uint32",
-	"writeFloat":       "float32",
-	"writeDouble":      "float64",
-	"writeUTF":         "string",
+// ScalarType describes a scalar written by one of the write methods of the
+// ICustomDataOutput interface
+type ScalarType struct {
+	WriteMethod string
+	ReadMethod  string // ReadMethod is the counterpart of WriteMethod, see compatibleReadMethods for the unsigned ones
+	Type        string // Type is the reduced type, integers then take the signedness of the field declaration
+	Bits        uint8  // Bits is the width of the value, 0 for strings. Var-length methods write up to Bits bits.
 }
 
+// ScalarTypes maps the write methods to the scalar they write. It is the
+// table the extraction reduces the fields with.
+var ScalarTypes = map[string]ScalarType{
+	"writeVarShort":    {"writeVarShort", "readVarShort", "int16", 16},
+	"writeVarInt":      {"writeVarInt", "readVarInt", "int32", 32},
+	"writeVarLong":     {"writeVarLong", "readVarLong", "int64", 64},
+	"writeBoolean":     {"writeBoolean", "readBoolean", "bool", 8},
+	"writeByte":        {"writeByte", "readByte", "int8", 8},
+	"writeShort":       {"writeShort", "readShort", "int16", 16},
+	"writeInt":         {"writeInt", "readInt", "int32", 32},
+	"writeUnsignedInt": {"writeUnsignedInt", "readUnsignedInt", "uint32", 32},
+	"writeFloat":       {"writeFloat", "readFloat", "float32", 32},
+	"writeDouble":      {"writeDouble", "readDouble", "float64", 64},
+	"writeUTF":         {"writeUTF", "readUTF", "string", 0},
+}
+
+// WireEncoding describes how a write method encodes its value
+type WireEncoding struct {
+	Bits     uint8 // Bits is the width of the value, 0 for strings
+	Size     int   // Size is the number of bytes written, at most for var-length integers, 0 for strings
+	Signed   bool  // Signed is set for signed integers and floats, fields still take the signedness of their declaration
+	IsVarInt bool  // IsVarInt is set for the var-length integers, written 7 bits per byte
+}
+
+// WriteMethodInfo returns the encoding of the write method with the given
+// name, like writeVarShort. It is derived from ScalarTypes.
+func WriteMethodInfo(name string) (WireEncoding, bool) {
+	scalar, ok := ScalarTypes[name]
+	if !ok {
+		return WireEncoding{}, false
+	}
+	enc := WireEncoding{
+		Bits:     scalar.Bits,
+		Size:     int(scalar.Bits) / 8,
+		Signed:   !strings.HasPrefix(scalar.Type, "uint") && scalar.Type != "bool" && scalar.Type != "string",
+		IsVarInt: strings.HasPrefix(name, "writeVar"),
+	}
+	if enc.IsVarInt {
+		enc.Size = (int(scalar.Bits) + 6) / 7
+	}
+	return enc, true
+}
+
+// reduceType replaces the AS3 type of f with the type of its write method,
+// see reduceSignedness for the signedness of integers. A Number has no
+// signedness, it is unsigned when the deserialize method reads it unsigned.
 func reduceType(f *Field) {
 	if f.Type == "Boolean" {
 		f.Type = "bool"
@@ -27,21 +68,94 @@ func reduceType(f *Field) {
 	} else if f.WriteMethod == "writeBytes" {
 		// hack to get NetworkDataContainerMessage working
 		f.IsVector = true
+		f.VectorDepth = 1
 		f.IsDynamicLength = true
 		f.WriteLengthMethod = "writeVarInt"
 		f.WriteMethod = "writeByte"
 	}
-	reduced, canReduce := writeMethodTypesMap[f.WriteMethod]
+	scalar, canReduce := ScalarTypes[f.WriteMethod]
 	if canReduce {
-		// Sometimes, unsigned variables are written with signed functions
-		if f.Type == "uint" && strings.HasPrefix(reduced, "int") {
-			reduced = "u" + reduced // dirty but works for intX types
+		as3Type := f.Type
+		if as3Type == "Number" && isUnsignedReadMethod(f.ReadMethod) {
+			as3Type = "uint"
 		}
-		f.Type = reduced
+		f.Type = reduceSignedness(scalar.Type, as3Type)
 	}
 	return
 }
 
+// isUnsignedReadMethod reports whether m reads an unsigned integer
+func isUnsignedReadMethod(m string) bool {
+	return strings.HasPrefix(m, "readVarUh") || strings.HasPrefix(m, "readUnsigned")
+}
+
+// hasSignednessMismatch reports whether f is declared as an int or an uint
+// but read with a method of the other signedness. The declaration wins, the
+// game stores the value in the field whatever the read method.
+func hasSignednessMismatch(f Field) bool {
+	if f.ReadMethod == "" || ScalarTypes[f.WriteMethod].ReadMethod == "" {
+		return false
+	}
+	switch f.RawType {
+	case "int":
+		return isUnsignedReadMethod(f.ReadMethod)
+	case "uint":
+		return !isUnsignedReadMethod(f.ReadMethod) && len(compatibleReadMethods[f.WriteMethod]) > 0
+	}
+	return false
+}
+
+// reduceSignedness applies the signedness of the AS3 type to an integer type
+// reduced from a write method. The write method only gives the width, the
+// same writeByte writes an int and a uint. A Number has no signedness and
+// keeps the one of the write method.
+func reduceSignedness(reduced, as3Type string) string {
+	switch {
+	case as3Type == "uint" && strings.HasPrefix(reduced, "int"):
+		return "u" + reduced
+	case as3Type == "int" && strings.HasPrefix(reduced, "uint"):
+		return strings.TrimPrefix(reduced, "u")
+	}
+	return reduced
+}
+
+// reduceReadMethod derives the read method from the write method when the
+// deserialize method did not give it
+func reduceReadMethod(f *Field) {
+	if f.ReadMethod == "" {
+		f.ReadMethod = ScalarTypes[f.WriteMethod].ReadMethod
+	}
+}
+
+// compatibleReadMethods lists the read methods that may deserialize a value
+// written by a write method besides the one of ScalarTypes,
+// unsigned fields are read with their unsigned counterpart
+var compatibleReadMethods = map[string][]string{
+	"writeVarShort": {"readVarUhShort"},
+	"writeVarInt":   {"readVarUhInt"},
+	"writeVarLong":  {"readVarUhLong"},
+	"writeByte":     {"readUnsignedByte"},
+	"writeShort":    {"readUnsignedShort"},
+	"writeInt":      {"readUnsignedInt"},
+}
+
+// isReadMethodConsistent reports whether the read method of f deserializes
+// what its write method serializes
+func isReadMethodConsistent(f Field) bool {
+	if f.ReadMethod == "" || f.WriteMethod == "" {
+		return true
+	}
+	if ScalarTypes[f.WriteMethod].ReadMethod == f.ReadMethod {
+		return true
+	}
+	for _, read := range compatibleReadMethods[f.WriteMethod] {
+		if read == f.ReadMethod {
+			return true
+		}
+	}
+	return false
+}
+
 var typesToMethodMap = map[string]string{
 	"int8":    "Int8",
 	"int16":   "Int16",
@@ -62,8 +176,80 @@ func reduceMethod(f *Field) {
 	if !ok || f.WriteMethod == "" {
 		return
 	}
-	if strings.Contains(f.WriteMethod, "Var") {
+	enc, _ := WriteMethodInfo(f.WriteMethod)
+	f.IsVarLength = enc.IsVarInt
+	if f.IsVarLength {
 		m = "Var" + m
 	}
 	f.Method = m
 }
+
+var lengthPrefixBitsMap = map[string]uint8{
+	"writeByte":        8,
+	"writeShort":       16,
+	"writeInt":         32,
+	"writeUnsignedInt": 32,
+}
+
+func reduceLengthPrefix(f *Field) {
+	if !f.IsDynamicLength {
+		return
+	}
+	f.LengthPrefixBits = lengthPrefixBitsMap[f.WriteLengthMethod]
+}
+
+// IsScalar reports whether the field holds a scalar value rather than a
+// protocol type
+func (f Field) IsScalar() bool {
+	_, ok := typesToMethodMap[f.Type]
+	return ok
+}
+
+// reduceBBWPositions turns the positions of the BooleanByteWrapper fields into
+// bit indexes across bytes. The serialize methods restart at position 0 for
+// each new byte, so fields must be sorted in wire order.
+func reduceBBWPositions(fields []Field) {
+	var byteIndex uint
+	last := -1
+	for i := range fields {
+		f := &fields[i]
+		if !f.UseBBW {
+			continue
+		}
+		if last >= 0 && int(f.BBWPosition) <= last {
+			byteIndex++
+		}
+		last = int(f.BBWPosition)
+		f.BBWPosition += byteIndex * 8
+	}
+}
+
+// BBWByte returns the index of the BooleanByteWrapper byte holding the field
+func (f Field) BBWByte() uint {
+	return f.BBWPosition / 8
+}
+
+// BBWBit returns the bit of the BooleanByteWrapper byte holding the field
+func (f Field) BBWBit() uint {
+	return f.BBWPosition % 8
+}
+
+// Dimensions returns the number of nested vectors of f. Fields that were not
+// extracted by this version of the parser may only have IsVector set, they
+// are considered as single vectors.
+func (f Field) Dimensions() int {
+	if f.VectorDepth == 0 && f.IsVector {
+		return 1
+	}
+	return f.VectorDepth
+}
+
+// AS3Type returns the AS3 type of f as declared in the class, vectors
+// included, like Vector<Vector<uint>>
+func (f Field) AS3Type() string {
+	if f.IsByteArray {
+		return f.RawType
+	}
+	n := f.Dimensions()
+	return strings.Repeat("Vector<", n) + f.RawType + strings.Repeat(">", n)
+}
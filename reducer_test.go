@@ -0,0 +1,269 @@
+package d2protocolparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestField_IsScalar(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  bool
+	}{
+		{"integer", Field{Name: "fightId", Type: "uint16", WriteMethod: "writeShort"}, true},
+		{"boolean", Field{Name: "autoconnect", Type: "bool", UseBBW: true}, true},
+		{"string", Field{Name: "lang", Type: "string", WriteMethod: "writeUTF"}, true},
+		{"byte vector", Field{Name: "content", Type: "uint8", IsVector: true}, true},
+		{"type", Field{Name: "look", Type: "EntityLook"}, false},
+		{"type vector", Field{Name: "characters", Type: "CharacterBaseInformations", IsVector: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.field.IsScalar(); got != tt.want {
+				t.Errorf("Field.IsScalar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestField_Dimensions(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  int
+	}{
+		{"scalar", Field{Type: "uint16"}, 0},
+		{"vector", Field{Type: "uint16", IsVector: true, VectorDepth: 1}, 1},
+		{"nested vector", Field{Type: "uint16", IsVector: true, VectorDepth: 2}, 2},
+		{"vector without depth", Field{Type: "uint16", IsVector: true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.field.Dimensions(); got != tt.want {
+				t.Errorf("Field.Dimensions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestField_AS3Type(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  string
+	}{
+		{"scalar", Field{Type: "uint16", RawType: "uint"}, "uint"},
+		{"vector", Field{Type: "uint16", RawType: "uint", IsVector: true, VectorDepth: 1}, "Vector<uint>"},
+		{"nested vector", Field{Type: "int8", RawType: "int", IsVector: true, VectorDepth: 2}, "Vector<Vector<int>>"},
+		{"byte array", Field{Type: "uint8", RawType: "ByteArray", IsVector: true, VectorDepth: 1, IsByteArray: true}, "ByteArray"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.field.AS3Type(); got != tt.want {
+				t.Errorf("Field.AS3Type() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reduceLengthPrefix(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  uint8
+	}{
+		{"byte", Field{IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeByte"}, 8},
+		{"short", Field{IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort"}, 16},
+		{"int", Field{IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeInt"}, 32},
+		{"var short", Field{IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarShort"}, 0},
+		{"var int", Field{IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeVarInt"}, 0},
+		{"static", Field{IsVector: true, Length: 5}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reduceLengthPrefix(&tt.field)
+			if tt.field.LengthPrefixBits != tt.want {
+				t.Errorf("reduceLengthPrefix() = %v, want %v", tt.field.LengthPrefixBits, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reduceType_Signedness(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  string
+	}{
+		// CharacterLevelUpMessage.newLevel and GameRolePlayGroupMonsterInformations.lootShare
+		{"unsigned byte", Field{Name: "newLevel", Type: "uint", WriteMethod: "writeByte"}, "uint8"},
+		{"signed byte", Field{Name: "lootShare", Type: "int", WriteMethod: "writeByte"}, "int8"},
+		{"unsigned var short", Field{Name: "figure", Type: "uint", WriteMethod: "writeVarShort"}, "uint16"},
+		{"signed unsigned int", Field{Name: "delta", Type: "int", WriteMethod: "writeUnsignedInt"}, "int32"},
+		{"unsigned unsigned int", Field{Name: "ageBonusRate", Type: "uint", WriteMethod: "writeUnsignedInt"}, "uint32"},
+		{"number", Field{Name: "sessionOptionalSalt", Type: "Number", WriteMethod: "writeVarLong", ReadMethod: "readVarLong"}, "int64"},
+		{"unsigned number", Field{Name: "targetId", Type: "Number", WriteMethod: "writeVarLong", ReadMethod: "readVarUhLong"}, "uint64"},
+		{"unsigned read int", Field{Name: "delta", Type: "int", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort"}, "int16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reduceType(&tt.field)
+			if tt.field.Type != tt.want {
+				t.Errorf("reduceType() = %v, want %v", tt.field.Type, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reduceMethod(t *testing.T) {
+	tests := []struct {
+		name            string
+		field           Field
+		wantMethod      string
+		wantIsVarLength bool
+	}{
+		{"var", Field{Type: "uint16", WriteMethod: "writeVarShort"}, "VarUInt16", true},
+		{"fixed", Field{Type: "uint16", WriteMethod: "writeShort"}, "UInt16", false},
+		{"string", Field{Type: "string", WriteMethod: "writeUTF"}, "String", false},
+		{"type", Field{Type: "EntityLook"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reduceMethod(&tt.field)
+			if tt.field.Method != tt.wantMethod || tt.field.IsVarLength != tt.wantIsVarLength {
+				t.Errorf("expected %v (var-length %v), got %v (var-length %v)", tt.wantMethod, tt.wantIsVarLength, tt.field.Method, tt.field.IsVarLength)
+			}
+		})
+	}
+}
+
+func Test_hasSignednessMismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  bool
+	}{
+		{"unsigned", Field{RawType: "uint", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort"}, false},
+		{"signed", Field{RawType: "int", WriteMethod: "writeShort", ReadMethod: "readShort"}, false},
+		{"int read unsigned", Field{RawType: "int", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort"}, true},
+		{"uint read signed", Field{RawType: "uint", WriteMethod: "writeVarInt", ReadMethod: "readVarInt"}, true},
+		{"uint without unsigned read", Field{RawType: "uint", WriteMethod: "writeUnsignedInt", ReadMethod: "readUnsignedInt"}, false},
+		{"number", Field{RawType: "Number", WriteMethod: "writeVarLong", ReadMethod: "readVarUhLong"}, false},
+		{"no read method", Field{RawType: "int", WriteMethod: "writeVarShort"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasSignednessMismatch(tt.field); got != tt.want {
+				t.Errorf("hasSignednessMismatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reduceType_Float(t *testing.T) {
+	tests := []struct {
+		name       string
+		field      Field
+		wantType   string
+		wantMethod string
+	}{
+		{"float", Field{Name: "ratio", Type: "Number", WriteMethod: "writeFloat"}, "float32", "Float"},
+		{"double", Field{Name: "contextualId", Type: "Number", WriteMethod: "writeDouble"}, "float64", "Double"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reduceType(&tt.field)
+			reduceMethod(&tt.field)
+			if tt.field.IsVarLength {
+				t.Errorf("expected %v not to be var-length", tt.field.WriteMethod)
+			}
+			if tt.field.Type != tt.wantType || tt.field.Method != tt.wantMethod {
+				t.Errorf("expected %v (%v), got %v (%v)", tt.wantType, tt.wantMethod, tt.field.Type, tt.field.Method)
+			}
+		})
+	}
+}
+
+func TestWriteMethodInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   WireEncoding
+		wantOk bool
+	}{
+		{"writeVarShort", WireEncoding{16, 3, true, true}, true},
+		{"writeVarInt", WireEncoding{32, 5, true, true}, true},
+		{"writeVarLong", WireEncoding{64, 10, true, true}, true},
+		{"writeShort", WireEncoding{16, 2, true, false}, true},
+		{"writeUnsignedInt", WireEncoding{32, 4, false, false}, true},
+		{"writeDouble", WireEncoding{64, 8, true, false}, true},
+		{"writeBoolean", WireEncoding{8, 1, false, false}, true},
+		{"writeUTF", WireEncoding{0, 0, false, false}, true},
+		{"writeBytes", WireEncoding{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := WriteMethodInfo(tt.name)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("WriteMethodInfo() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestScalarTypes(t *testing.T) {
+	for write, scalar := range ScalarTypes {
+		if scalar.WriteMethod != write {
+			t.Errorf("expected %v, got %v", write, scalar.WriteMethod)
+		}
+		if "read"+strings.TrimPrefix(write, "write") != scalar.ReadMethod {
+			t.Errorf("expected the read method of %v to mirror it, got %v", write, scalar.ReadMethod)
+		}
+		if _, ok := typesToMethodMap[scalar.Type]; !ok {
+			t.Errorf("expected %v of %v to have a method", scalar.Type, write)
+		}
+	}
+	if s := ScalarTypes["writeVarShort"]; s.Type != "int16" || s.Bits != 16 {
+		t.Errorf("expected writeVarShort to write 16 bits integers, got %v", s)
+	}
+}
+
+func Test_reduceReadMethod(t *testing.T) {
+	for write, read := range map[string]string{
+		"writeByte":     "readByte",
+		"writeShort":    "readShort",
+		"writeInt":      "readInt",
+		"writeVarShort": "readVarShort",
+		"writeVarInt":   "readVarInt",
+		"writeVarLong":  "readVarLong",
+		"writeFloat":    "readFloat",
+		"writeDouble":   "readDouble",
+		"writeBoolean":  "readBoolean",
+		"writeUTF":      "readUTF",
+		"":              "",
+	} {
+		f := Field{WriteMethod: write}
+		reduceReadMethod(&f)
+		if f.ReadMethod != read {
+			t.Errorf("expected %v for %v, got %v", read, write, f.ReadMethod)
+		}
+	}
+}
+
+func Test_reduceBBWPositions(t *testing.T) {
+	fields := []Field{{Name: "id", Type: "uint16"}}
+	for i := uint(0); i < 10; i++ {
+		fields = append(fields, Field{Name: "flag", Type: "bool", UseBBW: true, BBWPosition: i % 8})
+	}
+	fields = append(fields, Field{Name: "name", Type: "string"})
+
+	reduceBBWPositions(fields)
+	for i, f := range fields[1:11] {
+		if f.BBWPosition != uint(i) {
+			t.Errorf("expected position %v, got %v", i, f.BBWPosition)
+		}
+		if f.BBWByte() != uint(i)/8 || f.BBWBit() != uint(i)%8 {
+			t.Errorf("expected byte %v bit %v, got byte %v bit %v", i/8, i%8, f.BBWByte(), f.BBWBit())
+		}
+	}
+}
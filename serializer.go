@@ -0,0 +1,218 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrGenerateNoMethod means that a scalar field has no write method and can
+// not be serialized
+var ErrGenerateNoMethod = errors.New("scalar field has no write method")
+
+// ErrGeneratePolymorphic means that a field written with the type manager
+// may hold a subtype of its type, or that its type is abstract, which the
+// generated structs can not represent
+var ErrGeneratePolymorphic = errors.New("polymorphic type manager field is not supported")
+
+// lengthMethod returns the writer method used to write the length of a
+// dynamic vector, and the Go type of this length
+func lengthMethod(f Field) (string, string) {
+	l := Field{Type: "uint", WriteMethod: f.WriteLengthMethod}
+	reduceType(&l)
+	reduceMethod(&l)
+	return l.Method, l.Type
+}
+
+// methodGoType returns the Go type of the value written by a writer method
+func methodGoType(method string) string {
+	if method == "Bytes" {
+		return "[]byte"
+	}
+	m := strings.TrimPrefix(method, "Var")
+	for t, name := range typesToMethodMap {
+		if name == m {
+			return t
+		}
+	}
+	return "interface{}"
+}
+
+// serializerItem is either a single field or a group of fields packed in a
+// BooleanByteWrapper
+type serializerItem struct {
+	field Field
+	box   []Field
+}
+
+func serializerItems(fields []Field) []serializerItem {
+	var items []serializerItem
+	for _, f := range fields {
+		if !f.UseBBW {
+			items = append(items, serializerItem{field: f})
+			continue
+		}
+		last := len(items) - 1
+		if last >= 0 && items[last].box != nil && items[last].box[0].BBWByte() == f.BBWByte() {
+			items[last].box = append(items[last].box, f)
+			continue
+		}
+		items = append(items, serializerItem{box: []Field{f}})
+	}
+	return items
+}
+
+func writeGoFieldSerializer(buf *bytes.Buffer, c Class, f Field, value string, methods map[string]bool) error {
+	switch {
+	case f.Method != "":
+		methods[f.Method] = true
+		// aliased types and enumerations are converted to the type written
+		// by the method
+		if t := methodGoType(f.Method); t != goElemType(f) {
+			value = fmt.Sprintf("%v(%v)", t, value)
+		}
+		fmt.Fprintf(buf, "w.Write%v(%v)\n", f.Method, value)
+	case f.IsScalar():
+		return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNoMethod)
+	default:
+		if f.UseTypeManager {
+			method := "UInt16"
+			if f.TypeIDWriteMethod == "writeVarShort" {
+				method = "VarUInt16"
+			}
+			methods[method] = true
+			fmt.Fprintf(buf, "w.Write%v(%vProtocolID)\n", method, f.Type)
+		}
+		fmt.Fprintf(buf, "%v.Serialize(w)\n", value)
+	}
+	return nil
+}
+
+func writeGoSerializer(buf *bytes.Buffer, p *Protocol, c Class, methods map[string]bool) error {
+	fmt.Fprintf(buf, "// Serialize writes %v to w\n", c.Name)
+	fmt.Fprintf(buf, "func (m *%v) Serialize(w Writer) {\n", c.Name)
+	if c.Parent != "" {
+		fmt.Fprintf(buf, "m.%v.Serialize(w)\n", c.Parent)
+	}
+
+	boxes := 0
+	for _, item := range serializerItems(c.Fields) {
+		if item.box != nil {
+			box := fmt.Sprintf("box%v", boxes)
+			boxes++
+			fmt.Fprintf(buf, "var %v uint8\n", box)
+			for _, f := range item.box {
+				fmt.Fprintf(buf, "if m.%v {\n%v |= 1 << %v\n}\n", goExportedName(f.Name), box, f.BBWBit())
+			}
+			methods["UInt8"] = true
+			fmt.Fprintf(buf, "w.WriteUInt8(%v)\n", box)
+			continue
+		}
+
+		f := item.field
+		value := "m." + goExportedName(f.Name)
+		if f.PresenceFlag != "" {
+			fmt.Fprintf(buf, "if m.%v {\n", goExportedName(f.PresenceFlag))
+		}
+		if err := writeGoValueSerializer(buf, p, c, f, value, methods); err != nil {
+			return err
+		}
+		if f.PresenceFlag != "" {
+			buf.WriteString("}\n")
+		}
+	}
+	buf.WriteString("}\n\n")
+	return nil
+}
+
+// isPolymorphic reports whether a field written with the type manager may
+// hold another type than its own, or has no protocol id to write
+func isPolymorphic(p *Protocol, f Field) bool {
+	if !f.UseTypeManager {
+		return false
+	}
+	if t, ok := p.TypeByName(f.Type); ok && t.Abstract {
+		return true
+	}
+	return len(p.subtypes(f.Type)) > 0
+}
+
+// writeGoValueSerializer writes a field that is not packed in a
+// BooleanByteWrapper, along with its length for dynamic vectors
+func writeGoValueSerializer(buf *bytes.Buffer, p *Protocol, c Class, f Field, value string, methods map[string]bool) error {
+	if f.Dimensions() > 1 {
+		return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNestedVector)
+	}
+	if isPolymorphic(p, f) {
+		return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGeneratePolymorphic)
+	}
+	if !f.IsVector {
+		return writeGoFieldSerializer(buf, c, f, value, methods)
+	}
+	if f.IsDynamicLength {
+		method, t := lengthMethod(f)
+		if method == "" {
+			return fmt.Errorf("%v:%v : %w", c.Name, f.Name, ErrGenerateNoMethod)
+		}
+		methods[method] = true
+		fmt.Fprintf(buf, "w.Write%v(%v(len(%v)))\n", method, t, value)
+	}
+	if f.IsByteArray {
+		methods["Bytes"] = true
+		fmt.Fprintf(buf, "w.WriteBytes(%v)\n", value)
+		return nil
+	}
+	fmt.Fprintf(buf, "for _, v := range %v {\n", value)
+	if err := writeGoFieldSerializer(buf, c, f, "v", methods); err != nil {
+		return err
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// GenerateSerializers writes a Serialize method for every type and message
+// of the protocol to w. The methods are meant to be used alongside the
+// structs generated by GenerateGo and write the fields in wire order to a
+// Writer, whose interface is generated along with the methods, in the package
+// pkg. Fixed-length vectors are the arrays generated by GenerateGo.
+//
+// Fields using the type manager are written with the protocol id of their
+// declared type. The generation fails when that type is abstract or has
+// subtypes in p, since such a field may hold a value of another type, and
+// when a field is a vector of vectors.
+func GenerateSerializers(p *Protocol, w io.Writer, pkg string) error {
+	var body bytes.Buffer
+	methods := map[string]bool{}
+	for _, c := range p.Types {
+		if err := writeGoSerializer(&body, p, c, methods); err != nil {
+			return newError(err, "serializer generation failed")
+		}
+	}
+	for _, c := range p.Messages {
+		if err := writeGoSerializer(&body, p, c, methods); err != nil {
+			return newError(err, "serializer generation failed")
+		}
+	}
+
+	var names []string
+	for m := range methods {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by d2protocolparser. DO NOT EDIT.\n\npackage %v\n\n", pkg)
+	buf.WriteString("// Writer writes the primitive types of the protocol\n")
+	buf.WriteString("type Writer interface {\n")
+	for _, m := range names {
+		fmt.Fprintf(&buf, "Write%v(%v)\n", m, methodGoType(m))
+	}
+	buf.WriteString("}\n\n")
+	if _, err := body.WriteTo(&buf); err != nil {
+		return err
+	}
+	return writeGoSource(&buf, w)
+}
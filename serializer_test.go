@@ -0,0 +1,210 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSerializers(t *testing.T) {
+	expected, err := ioutil.ReadFile("./fixtures/serializers.go.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = GenerateSerializers(goldenProtocol(), &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), buf.String())
+	}
+}
+
+func TestGenerateSerializers_NoMethod(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "BrokenMessage", Fields: []Field{{Name: "id", Type: "uint16"}}},
+		},
+	}
+	if err := GenerateSerializers(p, ioutil.Discard, "protocol"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func Test_serializerItems(t *testing.T) {
+	var fields []Field
+	for i := uint(0); i < 10; i++ {
+		fields = append(fields, Field{Name: "flag", Type: "bool", UseBBW: true, BBWPosition: i})
+	}
+	items := serializerItems(fields)
+	if len(items) != 2 || len(items[0].box) != 8 || len(items[1].box) != 2 {
+		t.Errorf("expected boxes of 8 and 2 flags, got %v", items)
+	}
+}
+
+func TestGenerateSerializers_ByteArray(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "RawDataMessage", Fields: []Field{{
+				Name: "content", Type: "uint8", WriteMethod: "writeByte", Method: "UInt8",
+				IsVector: true, VectorDepth: 1, IsDynamicLength: true, WriteLengthMethod: "writeVarInt", IsByteArray: true,
+			}}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := GenerateSerializers(p, &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	for _, s := range []string{"WriteBytes([]byte)", "w.WriteVarUInt32(uint32(len(m.Content)))", "w.WriteBytes(m.Content)"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %v in %v", s, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "WriteUInt8") {
+		t.Errorf("expected no per byte write, got %v", buf.String())
+	}
+}
+
+func TestGenerateSerializers_PresenceFlag(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "GameFightFighterInformations", Fields: []Field{
+				{Name: "hasLook", Type: "bool", UseBBW: true},
+				{Name: "look", Type: "EntityLook", PresenceFlag: "hasLook"},
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := GenerateSerializers(p, &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := "\tif m.HasLook {\n\t\tm.Look.Serialize(w)\n\t}\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected %v in %v", expected, buf.String())
+	}
+}
+
+func TestGenerateSerializers_Float(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "MapCoordinatesRatio", Fields: []Field{
+				{Name: "ratio", Type: "float32", WriteMethod: "writeFloat", Method: "Float"},
+				{Name: "scale", Type: "float64", WriteMethod: "writeDouble", Method: "Double"},
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := GenerateSerializers(p, &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	for _, s := range []string{"WriteFloat(float32)", "w.WriteFloat(m.Ratio)", "w.WriteDouble(m.Scale)"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %v in %v", s, buf.String())
+		}
+	}
+}
+
+func TestGenerateSerializers_TypeIDWriteMethod(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "GameRolePlayActorInformations", Fields: []Field{
+				{Name: "disposition", Type: "EntityDispositionInformations", UseTypeManager: true, TypeIDWriteMethod: "writeVarShort"},
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := GenerateSerializers(p, &buf, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	for _, s := range []string{"WriteVarUInt16(uint16)", "w.WriteVarUInt16(EntityDispositionInformationsProtocolID)"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %v in %v", s, buf.String())
+		}
+	}
+}
+
+func TestGenerateSerializers_Unsupported(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []Class
+		want  error
+	}{
+		{
+			"nested vector",
+			[]Class{{Name: "MapComplementaryInformations", Fields: []Field{
+				{Name: "cells", Type: "int16", WriteMethod: "writeShort", Method: "Int16", IsVector: true, VectorDepth: 2, IsDynamicLength: true, WriteLengthMethod: "writeShort"},
+			}}},
+			ErrGenerateNestedVector,
+		},
+		{
+			"subtypes",
+			[]Class{
+				{Name: "GameRolePlayShowActor", Fields: []Field{{Name: "informations", Type: "GameContextActorInformations", UseTypeManager: true}}},
+				{Name: "GameContextActorInformations", ProtocolID: 150},
+				{Name: "GameRolePlayActorInformations", Parent: "GameContextActorInformations", ProtocolID: 141},
+			},
+			ErrGeneratePolymorphic,
+		},
+		{
+			"abstract",
+			[]Class{
+				{Name: "GameRolePlayShowActor", Fields: []Field{{Name: "informations", Type: "AbstractActorInformations", UseTypeManager: true}}},
+				{Name: "AbstractActorInformations", Abstract: true},
+			},
+			ErrGeneratePolymorphic,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := GenerateSerializers(&Protocol{Types: tt.types}, ioutil.Discard, "protocol"); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGenerateSerializers_TypeAliases(t *testing.T) {
+	b := &Builder{opts: BuildOptions{TypeAliases: map[string]string{"int16": "int32", "uint16": "int32"}}}
+	fields := []Field{
+		{Name: "serverId", Type: "int16", WriteMethod: "writeShort", Method: "Int16"},
+		{Name: "failedAttempts", Type: "uint16", WriteMethod: "writeVarShort", Method: "VarUInt16", IsVector: true, IsDynamicLength: true, WriteLengthMethod: "writeShort"},
+	}
+	for i := range fields {
+		b.aliasType(&fields[i])
+	}
+	p := &Protocol{Messages: []Class{{Name: "IdentificationMessage", ProtocolID: 4, Fields: fields}}}
+
+	var structs, serializers bytes.Buffer
+	if err := GenerateGo(p, &structs, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := GenerateSerializers(p, &serializers, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := typeCheckGo(structs.String(), serializers.String()); err != nil {
+		t.Errorf("expected the generated files to compile together, got %v", err)
+	}
+}
+
+func TestGenerateSerializers_FixedLength(t *testing.T) {
+	p := &Protocol{Types: []Class{{Name: "MapCoordinatesAndId", ProtocolID: 392, Fields: []Field{
+		{Name: "coords", Type: "int16", WriteMethod: "writeShort", Method: "Int16", IsVector: true, IsFixedLength: true, Length: 2},
+	}}}}
+
+	var structs, serializers bytes.Buffer
+	if err := GenerateGo(p, &structs, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := GenerateSerializers(p, &serializers, "protocol"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if !strings.Contains(structs.String(), "Coords [2]int16") {
+		t.Errorf("expected a fixed size array in %v", structs.String())
+	}
+	if err := typeCheckGo(structs.String(), serializers.String()); err != nil {
+		t.Errorf("expected the generated files to compile together, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package d2protocolparser
+
+// ProtocolStats counts the classes of a protocol and the kinds of fields they
+// declare. A sudden change between two versions usually means that an
+// extraction pattern stopped matching.
+type ProtocolStats struct {
+	Messages int
+	Types    int
+	Enums    int
+
+	Fields               int
+	BBWFields            int
+	TypeManagerFields    int
+	VectorFields         int
+	DynamicLengthVectors int
+	FixedLengthVectors   int
+	ByteArrayFields      int
+	HashedMessages       int
+}
+
+// Stats computes the statistics of p. The fields of the parents are not
+// counted again for their children.
+func (p *Protocol) Stats() ProtocolStats {
+	s := ProtocolStats{
+		Messages: len(p.Messages),
+		Types:    len(p.Types),
+		Enums:    len(p.Enums),
+	}
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			if c.UseHashFunc {
+				s.HashedMessages++
+			}
+			for _, f := range c.Fields {
+				s.Fields++
+				if f.UseBBW {
+					s.BBWFields++
+				}
+				if f.UseTypeManager {
+					s.TypeManagerFields++
+				}
+				if f.IsByteArray {
+					s.ByteArrayFields++
+				}
+				if !f.IsVector {
+					continue
+				}
+				s.VectorFields++
+				if f.IsDynamicLength {
+					s.DynamicLengthVectors++
+				}
+				if f.IsFixedLength {
+					s.FixedLengthVectors++
+				}
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+package d2protocolparser
+
+import "testing"
+
+func TestProtocol_Stats(t *testing.T) {
+	expected := ProtocolStats{
+		Messages: 3,
+		Types:    2,
+		Enums:    1,
+
+		Fields:               18,
+		BBWFields:            3,
+		TypeManagerFields:    2,
+		VectorFields:         3,
+		DynamicLengthVectors: 3,
+	}
+	if got := goldenProtocol().Stats(); got != expected {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
@@ -0,0 +1,103 @@
+package d2protocolparser
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/kelvyne/as3"
+)
+
+// ClassResult is a message, a type or an enumeration extracted by Stream, or
+// the error that prevented its extraction
+type ClassResult struct {
+	Class     Class // Class is set for messages and types
+	Enum      Enum  // Enum is set for enumerations
+	IsMessage bool
+	IsEnum    bool
+	Err       error
+}
+
+// Stream extracts the messages, types and enumerations and sends them on the
+// returned channel in the order of the abc file as soon as they are ready.
+// The classes are extracted concurrently, using one goroutine per CPU. The
+// channel is closed once every class is sent or when ctx is done.
+func (b *Builder) Stream(ctx context.Context) (<-chan ClassResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out := make(chan ClassResult)
+	go func() {
+		defer close(out)
+		for _, part := range b.parts() {
+			if !part.stream(ctx, out) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// stream sends the classes of the DoABC tag of b to out in order. It returns
+// false when ctx is done before every class is sent.
+func (b *Builder) stream(ctx context.Context, out chan<- ClassResult) bool {
+	classes := b.abcFile.Classes
+	kinds := make([]classKind, len(classes))
+	results := make([]ClassResult, len(classes))
+	ready := make([]chan struct{}, len(classes))
+	var indexes []int
+	for i, class := range classes {
+		kinds[i] = b.classKind(class)
+		ready[i] = make(chan struct{})
+		if kinds[i] == kindNone {
+			close(ready[i])
+		} else {
+			indexes = append(indexes, i)
+		}
+	}
+
+	jobs := make(chan int)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		go func() {
+			for i := range jobs {
+				results[i] = b.extractResult(classes[i], kinds[i])
+				close(ready[i])
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, i := range indexes {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for i := range classes {
+		select {
+		case <-ready[i]:
+		case <-ctx.Done():
+			return false
+		}
+		if kinds[i] == kindNone {
+			continue
+		}
+		select {
+		case out <- results[i]:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Builder) extractResult(class as3.Class, kind classKind) ClassResult {
+	if kind == kindEnum {
+		e, err := b.ExtractEnum(class)
+		return ClassResult{Enum: e, IsEnum: true, Err: err}
+	}
+	c, err := b.ExtractClass(class)
+	return ClassResult{Class: c, IsMessage: kind == kindMessage, Err: err}
+}
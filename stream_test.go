@@ -0,0 +1,52 @@
+package d2protocolparser
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kelvyne/as3"
+	"github.com/kelvyne/as3/bytecode"
+)
+
+func TestBuilder_Stream(t *testing.T) {
+	enum := func(name string) as3.Class {
+		return as3.Class{Name: name, Namespace: "com.ankamagames.dofus.network.enums"}
+	}
+	part := func(classes ...as3.Class) *Builder {
+		return &Builder{abcFile: &as3.AbcFile{Source: &bytecode.AbcFile{}, Classes: classes}}
+	}
+	b := part(enum("AlignmentSideEnum"), as3.Class{Name: "Main"}, enum("ChatActivableChannelsEnum"))
+	b.others = []*Builder{part(enum("AccessoryPreviewErrorEnum"))}
+
+	results, err := b.Stream(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	var got []string
+	for r := range results {
+		if r.Err != nil || !r.IsEnum {
+			t.Errorf("expected an enumeration, got %v", r)
+		}
+		got = append(got, r.Enum.Name)
+	}
+	expected := []string{"AlignmentSideEnum", "ChatActivableChannelsEnum", "AccessoryPreviewErrorEnum"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// the channel is closed once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err = b.Stream(ctx)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	<-results
+	cancel()
+	for range results {
+	}
+
+	if _, err = b.Stream(ctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,58 @@
+package d2protocolparser
+
+import (
+	"github.com/kelvyne/as3"
+	"github.com/kelvyne/as3/bytecode"
+)
+
+// PatternMatch is a pattern recognized in a serialize method
+type PatternMatch struct {
+	Pattern string // Pattern is the name of the handler, like handleSimpleProp
+	Offset  int
+	Field   string // Field is empty when the handler did not touch a field
+}
+
+// SkippedInstructions is a run of instructions of a serialize method that no
+// pattern recognized
+type SkippedInstructions struct {
+	Offset       int
+	Instructions []string
+}
+
+// ClassTrace tells how the serialize method of a class was interpreted
+type ClassTrace struct {
+	Class   string
+	Matches []PatternMatch
+	Skipped []SkippedInstructions
+}
+
+func (t *ClassTrace) match(pattern string, offset int, f *Field) {
+	if t == nil {
+		return
+	}
+	m := PatternMatch{Pattern: pattern, Offset: offset}
+	if f != nil {
+		m.Field = f.Name
+	}
+	t.Matches = append(t.Matches, m)
+}
+
+func (t *ClassTrace) skip(instrs []bytecode.Instr, offset int) {
+	if t == nil || len(instrs) == 0 {
+		return
+	}
+	names := make([]string, len(instrs))
+	for i, instr := range instrs {
+		names[i] = instr.Model.Name
+	}
+	t.Skipped = append(t.Skipped, SkippedInstructions{offset, names})
+}
+
+// ExtractClassTrace is like ExtractClass but also returns the patterns that
+// matched the serialize method of class and the instructions they skipped.
+// It is meant to audit the extraction of a new client.
+func (b *Builder) ExtractClassTrace(class as3.Class) (Class, ClassTrace, error) {
+	trace := &ClassTrace{Class: class.Name}
+	c, err := b.extractClass(class, trace)
+	return c, *trace, err
+}
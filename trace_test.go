@@ -0,0 +1,45 @@
+package d2protocolparser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kelvyne/as3"
+	"github.com/kelvyne/as3/bytecode"
+)
+
+func Test_Builder_extractSerializeMethods_Trace(t *testing.T) {
+	b := newTestBuilder("figure", "writeVarShort", "look")
+	instrs := []bytecode.Instr{
+		// output.writeVarShort(this.figure);
+		instr("getlocal1"), instr("getlocal0"), instr("getproperty", 1), instr("callpropvoid", 2, 1),
+		// this.look.serializeAs_EntityLook(output);
+		instr("getlocal0"), instr("getproperty", 3), instr("getlocal1"),
+	}
+	fields := map[string]*Field{"figure": {Name: "figure"}, "look": {Name: "look"}}
+
+	trace := &ClassTrace{Class: "KrosmasterFigure"}
+	if _, err := b.extractSerializeMethods(as3.Class{Name: "KrosmasterFigure"}, "serializeAs_KrosmasterFigure", instrs, fields, trace); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := ClassTrace{
+		Class: "KrosmasterFigure",
+		Matches: []PatternMatch{
+			{"handleSimpleProp", 2, "figure"},
+			{"handleGetProperty", 5, "look"},
+		},
+		Skipped: []SkippedInstructions{
+			{0, []string{"getlocal1", "getlocal0"}},
+			{4, []string{"getlocal0"}},
+			{6, []string{"getlocal1"}},
+		},
+	}
+	if !reflect.DeepEqual(*trace, expected) {
+		t.Errorf("expected %v, got %v", expected, *trace)
+	}
+
+	// the extraction does not record anything without a trace
+	if _, err := b.extractSerializeMethods(as3.Class{Name: "KrosmasterFigure"}, "serializeAs_KrosmasterFigure", instrs, fields, nil); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var typeScriptTypesMap = map[string]string{
+	"int8":    "number",
+	"int16":   "number",
+	"int32":   "number",
+	"int64":   "number",
+	"uint8":   "number",
+	"uint16":  "number",
+	"uint32":  "number",
+	"uint64":  "number",
+	"float32": "number",
+	"float64": "number",
+	"int":     "number",
+	"uint":    "number",
+	"Number":  "number",
+	"string":  "string",
+	"String":  "string",
+	"bool":    "boolean",
+}
+
+func typeScriptType(f Field) string {
+	t, ok := typeScriptTypesMap[f.Type]
+	if !ok {
+		t = f.Type
+	}
+	return t + strings.Repeat("[]", f.Dimensions())
+}
+
+func writeTypeScriptInterface(buf *bytes.Buffer, c Class) {
+	// the protocol id is not a member of the interface since a child can not
+	// redefine the literal type of its parent member, an abstract class has
+	// none
+	if !c.Abstract {
+		fmt.Fprintf(buf, "export const %vProtocolId = %v;\n\n", c.Name, c.ProtocolID)
+	}
+	fmt.Fprintf(buf, "export interface %v", c.Name)
+	if c.Parent != "" {
+		fmt.Fprintf(buf, " extends %v", c.Parent)
+	}
+	buf.WriteString(" {\n")
+	for _, f := range c.Fields {
+		fmt.Fprintf(buf, "  %v: %v;\n", f.Name, typeScriptType(f))
+	}
+	buf.WriteString("}\n\n")
+}
+
+// GenerateTypeScript writes the TypeScript declarations of every enum, type
+// and message of the protocol to w. Each interface is preceded by a const
+// holding its protocol id.
+func GenerateTypeScript(p *Protocol, w io.Writer) error {
+	var buf bytes.Buffer
+	for _, e := range p.Enums {
+		fmt.Fprintf(&buf, "export enum %v {\n", e.Name)
+		for _, v := range e.Values {
+			fmt.Fprintf(&buf, "  %v = %v,\n", v.Name, v.Value)
+		}
+		buf.WriteString("}\n\n")
+	}
+	for _, c := range p.Types {
+		writeTypeScriptInterface(&buf, c)
+	}
+	for _, c := range p.Messages {
+		writeTypeScriptInterface(&buf, c)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,98 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTypeScript(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{
+				Name:       "IdentificationSuccessWithLoginTokenMessage",
+				Parent:     "IdentificationSuccessMessage",
+				ProtocolID: 6209,
+				Fields: []Field{
+					{Name: "loginToken", Type: "string"},
+				},
+			},
+		},
+		Types: []Class{
+			{
+				Name:       "KrosmasterFigure",
+				ProtocolID: 397,
+				Fields: []Field{
+					{Name: "figure", Type: "uint16"},
+					{Name: "bound", Type: "bool"},
+					{Name: "look", Type: "EntityLook", IsVector: true},
+				},
+			},
+		},
+		Enums: []Enum{
+			{"AlignmentSideEnum", []EnumValue{{"ALIGNMENT_UNKNOWN", -2}, {"ALIGNMENT_NEUTRAL", 0}}, "int", false, "int8"},
+		},
+	}
+
+	expected := `export enum AlignmentSideEnum {
+  ALIGNMENT_UNKNOWN = -2,
+  ALIGNMENT_NEUTRAL = 0,
+}
+
+export const KrosmasterFigureProtocolId = 397;
+
+export interface KrosmasterFigure {
+  figure: number;
+  bound: boolean;
+  look: EntityLook[];
+}
+
+export const IdentificationSuccessWithLoginTokenMessageProtocolId = 6209;
+
+export interface IdentificationSuccessWithLoginTokenMessage extends IdentificationSuccessMessage {
+  loginToken: string;
+}
+
+`
+	var buf bytes.Buffer
+	if err := GenerateTypeScript(p, &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected %v, got %v", expected, buf.String())
+	}
+}
+
+func TestGenerateTypeScript_IdentificationMessage(t *testing.T) {
+	expected, err := ioutil.ReadFile("./fixtures/IdentificationMessage.ts.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Builder{abcFile: open(t)}
+	c, err := b.ExtractClassByName("IdentificationMessage")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = GenerateTypeScript(&Protocol{Messages: []Class{c}}, &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected %v, got %v", string(expected), buf.String())
+	}
+}
+
+func TestGenerateTypeScript_Abstract(t *testing.T) {
+	p := &Protocol{Types: []Class{{Name: "AbstractSocialGroupInfos", Abstract: true}}}
+
+	var buf bytes.Buffer
+	if err := GenerateTypeScript(p, &buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if strings.Contains(buf.String(), "ProtocolId") {
+		t.Errorf("expected no protocol id, got %v", buf.String())
+	}
+}
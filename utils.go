@@ -16,6 +16,17 @@ func findMethodWithPrefix(c as3.Class, prefix string) (bytecode.TraitsInfo, bool
 	return bytecode.TraitsInfo{}, false
 }
 
+// methodNameWithPrefix returns the name of the method found by
+// findMethodWithPrefix
+func methodNameWithPrefix(c as3.Class, prefix string) string {
+	for _, t := range c.InstanceTraits.Methods {
+		if strings.HasPrefix(t.Name, prefix) {
+			return t.Name
+		}
+	}
+	return ""
+}
+
 func isPublicQName(abc *as3.AbcFile, m bytecode.MultinameInfo) bool {
 	if m.Kind != bytecode.MultinameKindQName {
 		return false
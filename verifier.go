@@ -3,16 +3,34 @@ package d2protocolparser
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // ErrVerifyNoStaticLength means that a vector field that has a static length
 // does not have a static length
 var ErrVerifyNoStaticLength = errors.New("vector field has no length")
 
-// ErrVerifyScalarNoWrite means that an as3 scalar type (int, uint, Number) field
-// has no write method set
+// ErrVerifyAmbiguousLength means that a vector field is marked as having both
+// a fixed and a dynamic length
+var ErrVerifyAmbiguousLength = errors.New("vector field has both a fixed and a dynamic length")
+
+// ErrVerifyScalarNoWrite means that a scalar type (int, uint, Number, String)
+// field has no write method set
 var ErrVerifyScalarNoWrite = errors.New("scalar type has no write method")
 
+// ErrVerifyUnknownType means that a field references a type that is neither a
+// type nor an enumeration of the protocol
+var ErrVerifyUnknownType = errors.New("field type is not part of the protocol")
+
+// ErrVerifyDuplicateProtocolID means that two messages share the same protocol
+// id
+var ErrVerifyDuplicateProtocolID = errors.New("duplicate message protocol id")
+
+// ErrVerifyReadWriteMismatch means that the read method of a field does not
+// deserialize what its write method serializes. The game itself has such
+// asymmetries, they are only an error in strict mode.
+var ErrVerifyReadWriteMismatch = errors.New("read method does not match write method")
+
 type verifyError struct {
 	err error
 	c   Class
@@ -23,16 +41,239 @@ func (e verifyError) Error() string {
 	return fmt.Sprintf("%v:%v : %v", e.c.Name, e.f.Name, e.err)
 }
 
-// Verify checks that a Protocol is well-formed and that it is complete
+// unknownTypesError lists every field whose type is not part of the protocol
+type unknownTypesError struct {
+	refs []string
+}
+
+func (e unknownTypesError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrVerifyUnknownType, strings.Join(e.refs, ", "))
+}
+
+func (e unknownTypesError) Unwrap() error {
+	return ErrVerifyUnknownType
+}
+
+// noWriteMethodError lists every scalar field without a write method
+type noWriteMethodError struct {
+	fields []string
+}
+
+func (e noWriteMethodError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrVerifyScalarNoWrite, strings.Join(e.fields, ", "))
+}
+
+func (e noWriteMethodError) Unwrap() error {
+	return ErrVerifyScalarNoWrite
+}
+
+// readWriteMismatchError lists every field whose read method does not match
+// its write method
+type readWriteMismatchError struct {
+	fields []string
+}
+
+func (e readWriteMismatchError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrVerifyReadWriteMismatch, strings.Join(e.fields, ", "))
+}
+
+func (e readWriteMismatchError) Unwrap() error {
+	return ErrVerifyReadWriteMismatch
+}
+
+// duplicateID is a protocol id claimed by several messages
+type duplicateID struct {
+	id    uint16
+	names []string
+}
+
+// duplicateIDError lists every protocol id shared by several messages, in
+// the order the ids first appear
+type duplicateIDError struct {
+	ids []duplicateID
+}
+
+func (e duplicateIDError) Error() string {
+	collisions := make([]string, len(e.ids))
+	for i, d := range e.ids {
+		collisions[i] = fmt.Sprintf("%v (%v)", d.id, strings.Join(d.names, ", "))
+	}
+	return fmt.Sprintf("%v: %v", ErrVerifyDuplicateProtocolID, strings.Join(collisions, ", "))
+}
+
+func (e duplicateIDError) Unwrap() error {
+	return ErrVerifyDuplicateProtocolID
+}
+
+// Verify checks that a Protocol is well-formed and that it is complete:
+// scalar fields of every type and message have a write method, all the
+// fields without one are listed in the error, vectors have exactly one kind
+// of length, every field type is part of the protocol and message protocol
+// ids are unique. Read methods that do not match their write method are not
+// checked, see verifyReadMethods.
 func Verify(p *Protocol) error {
+	return verify(p, true)
+}
+
+// verify checks p, the field types are only resolved when refs is set since
+// a filtered build does not contain every type
+func verify(p *Protocol, refs bool) error {
+	if err := verifyWriteMethods(p); err != nil {
+		return err
+	}
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			if err := verifyClass(c); err != nil {
+				return err
+			}
+		}
+	}
+	if err := verifyProtocolIDs(p); err != nil {
+		return err
+	}
+	if !refs {
+		return nil
+	}
+	return verifyTypeRefs(p)
+}
+
+// verifyProtocolIDs checks that no two messages share a protocol id, every
+// collision is returned in one error. Types ids are not used to route
+// anything and are not checked. Abstract messages have no id.
+func verifyProtocolIDs(p *Protocol) error {
+	var order []uint16
+	names := make(map[uint16][]string, len(p.Messages))
+	for _, m := range p.Messages {
+		if m.Abstract {
+			continue
+		}
+		if _, ok := names[m.ProtocolID]; !ok {
+			order = append(order, m.ProtocolID)
+		}
+		names[m.ProtocolID] = append(names[m.ProtocolID], m.Name)
+	}
+
+	var dups []duplicateID
+	for _, id := range order {
+		if len(names[id]) > 1 {
+			dups = append(dups, duplicateID{id, names[id]})
+		}
+	}
+	if len(dups) > 0 {
+		return duplicateIDError{dups}
+	}
+	return nil
+}
+
+// verifyWriteMethods checks that every scalar field has a write method, the
+// offending fields are all returned in one error since each of them would
+// make a decoder read garbage
+func verifyWriteMethods(p *Protocol) error {
+	var fields []string
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			for _, f := range c.Fields {
+				if hasNoWriteMethod(f) {
+					fields = append(fields, c.Name+"."+f.Name)
+				}
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return noWriteMethodError{fields}
+	}
+	return nil
+}
+
+// verifyReadMethods checks that the read method of every field deserializes
+// what its write method serializes, the offending fields are all returned in
+// one error
+func verifyReadMethods(p *Protocol) error {
+	var fields []string
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			for _, f := range c.Fields {
+				// e.g. written with writeVarShort but read with readShort
+				if !isReadMethodConsistent(f) {
+					fields = append(fields, fmt.Sprintf("%v.%v (%v, %v)", c.Name, f.Name, f.WriteMethod, f.ReadMethod))
+				}
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return readWriteMismatchError{fields}
+	}
+	return nil
+}
+
+// hasNoWriteMethod reports whether f is a scalar whose serialize method was
+// not matched. Fields of types and booleans packed in a BooleanByteWrapper
+// have no write method of their own.
+func hasNoWriteMethod(f Field) bool {
+	return isScalarType(f) && !f.UseTypeManager && f.WriteMethod == "" && !(f.Type == "bool" && f.UseBBW)
+}
+
+func isScalarType(f Field) bool {
+	return f.IsScalar() || isAs3ScalarType(f.Type) || f.Type == "Number" || f.Type == "String" || f.Type == "Boolean"
+}
+
+// verifyTypeRefs checks that the type of every non scalar field is a type or
+// an enumeration of p. The dangling references are all returned in one error.
+func verifyTypeRefs(p *Protocol) error {
+	known := map[string]bool{}
 	for _, t := range p.Types {
-		if err := verifyClass(t); err != nil {
-			return err
+		known[t.Name] = true
+	}
+	for _, e := range p.Enums {
+		known[e.Name] = true
+	}
+
+	var refs []string
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			for _, f := range c.Fields {
+				if !isScalarType(f) && !known[f.Type] {
+					refs = append(refs, fmt.Sprintf("%v:%v (%v)", c.Name, f.Name, f.Type))
+				}
+			}
 		}
 	}
+	if len(refs) > 0 {
+		return unknownTypesError{refs}
+	}
 	return nil
 }
 
+// verifyLenient removes the types and messages that are not well-formed from
+// p and returns their errors
+func verifyLenient(p *Protocol) []error {
+	var errs []error
+	valid := func(classes []Class) []Class {
+		var kept []Class
+		for _, c := range classes {
+			if err := verifyClass(c); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			kept = append(kept, c)
+		}
+		return kept
+	}
+	p.Types = valid(p.Types)
+	p.Messages = valid(p.Messages)
+	if err := verifyProtocolIDs(p); err != nil {
+		errs = append(errs, err)
+	}
+	if err := verifyTypeRefs(p); err != nil {
+		errs = append(errs, err)
+	}
+	// the classes are kept, their fields are still usable
+	if err := verifyReadMethods(p); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
 func verifyClass(c Class) error {
 	for _, f := range c.Fields {
 		if err := verifyField(f); err != nil {
@@ -43,13 +284,16 @@ func verifyClass(c Class) error {
 }
 
 func verifyField(f Field) error {
-	// scalar type but no write method
-	if isAs3ScalarType(f.Type) && f.WriteMethod == "" && !(f.Type == "bool" && f.UseBBW) {
+	// scalar type but no write method, the serialize method was not matched
+	if hasNoWriteMethod(f) {
 		return ErrVerifyScalarNoWrite
 	}
 	// vector with static type but no length
-	if f.IsVector && !f.IsDynamicLength && f.Length == 0 && f.Type != "ByteArray" {
+	if f.IsVector && !f.IsDynamicLength && (!f.IsFixedLength || f.Length == 0) && f.Type != "ByteArray" {
 		return ErrVerifyNoStaticLength
 	}
+	if f.IsFixedLength && f.IsDynamicLength {
+		return ErrVerifyAmbiguousLength
+	}
 	return nil
 }
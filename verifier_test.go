@@ -0,0 +1,218 @@
+package d2protocolparser
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_verifyLenient(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "Valid", Fields: []Field{{Name: "id", Type: "uint16", WriteMethod: "writeShort"}}},
+			{Name: "NoLength", Fields: []Field{{Name: "ids", Type: "uint16", WriteMethod: "writeShort", IsVector: true}}},
+			{Name: "NoWrite", Fields: []Field{{Name: "id", Type: "uint16"}}},
+		},
+		Messages: []Class{
+			{Name: "ValidMessage", Fields: []Field{{Name: "lang", Type: "string", WriteMethod: "writeUTF"}}},
+			{Name: "NoWriteMessage", Fields: []Field{{Name: "lang", Type: "string"}}},
+		},
+	}
+
+	errs := verifyLenient(p)
+	if len(errs) != 3 {
+		t.Errorf("expected 3 errors, got %v", errs)
+	}
+	if len(p.Types) != 1 || p.Types[0].Name != "Valid" {
+		t.Errorf("expected only Valid to be kept, got %v", p.Types)
+	}
+	if len(p.Messages) != 1 || p.Messages[0].Name != "ValidMessage" {
+		t.Errorf("expected only ValidMessage to be kept, got %v", p.Messages)
+	}
+}
+
+func Test_verifyField(t *testing.T) {
+	tests := []struct {
+		name  string
+		field Field
+		want  error
+	}{
+		{"scalar", Field{Type: "uint16", WriteMethod: "writeShort"}, nil},
+		{"bbw", Field{Type: "bool", UseBBW: true}, nil},
+		{"read", Field{Type: "uint16", WriteMethod: "writeVarShort", ReadMethod: "readVarShort"}, nil},
+		{"unsigned read", Field{Type: "uint16", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort"}, nil},
+		{"scalar no write", Field{Type: "uint16"}, ErrVerifyScalarNoWrite},
+		{"string no write", Field{Type: "string"}, ErrVerifyScalarNoWrite},
+		{"number no write", Field{Type: "Number"}, ErrVerifyScalarNoWrite},
+		{"bool no write", Field{Type: "bool"}, ErrVerifyScalarNoWrite},
+		{"type", Field{Type: "EntityLook"}, nil},
+		{"type manager", Field{Type: "EntityDispositionInformations", UseTypeManager: true}, nil},
+		{"dynamic vector", Field{Type: "uint16", WriteMethod: "writeShort", IsVector: true, IsDynamicLength: true}, nil},
+		{"fixed vector", Field{Type: "uint16", WriteMethod: "writeShort", IsVector: true, IsFixedLength: true, Length: 5}, nil},
+		{"vector no length", Field{Type: "uint16", WriteMethod: "writeShort", IsVector: true}, ErrVerifyNoStaticLength},
+		{"fixed vector no length", Field{Type: "uint16", WriteMethod: "writeShort", IsVector: true, IsFixedLength: true}, ErrVerifyNoStaticLength},
+		{"ambiguous vector", Field{Type: "uint16", WriteMethod: "writeShort", IsVector: true, IsDynamicLength: true, IsFixedLength: true, Length: 5}, ErrVerifyAmbiguousLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyField(tt.field); err != tt.want {
+				t.Errorf("verifyField() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_verifyReadMethods(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "KrosmasterFigure", Fields: []Field{
+				{Name: "figure", Type: "uint16", WriteMethod: "writeVarShort", ReadMethod: "readVarUhShort"},
+				{Name: "pedestal", Type: "uint16", WriteMethod: "writeVarShort", ReadMethod: "readShort"},
+			}},
+		},
+		Messages: []Class{
+			{Name: "IdentificationMessage", Fields: []Field{{Name: "serverId", Type: "int16", WriteMethod: "writeShort", ReadMethod: "readByte"}}},
+		},
+	}
+
+	err := verifyReadMethods(p)
+	if !errors.Is(err, ErrVerifyReadWriteMismatch) {
+		t.Fatalf("expected %v, got %v", ErrVerifyReadWriteMismatch, err)
+	}
+	expected := []string{"KrosmasterFigure.pedestal (writeVarShort, readShort)", "IdentificationMessage.serverId (writeShort, readByte)"}
+	if got := err.(readWriteMismatchError).fields; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if err = Verify(p); err != nil {
+		t.Errorf("expected the mismatch not to fail Verify, got %v", err)
+	}
+}
+
+func TestBuilder_verifyProtocol_ReadWriteMismatch(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "KrosmasterFigure", Fields: []Field{
+				{Name: "pedestal", Type: "uint16", WriteMethod: "writeVarShort", ReadMethod: "readShort"},
+			}},
+		},
+	}
+
+	var logs bytes.Buffer
+	b := &Builder{opts: BuildOptions{Logger: log.New(&logs, "", 0)}}
+	if err := b.verifyProtocol(p); err != nil {
+		t.Errorf("expected a non strict build to succeed, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "KrosmasterFigure.pedestal") {
+		t.Errorf("expected the mismatch to be logged, got %v", logs.String())
+	}
+
+	b = &Builder{opts: BuildOptions{Strict: true}}
+	if err := b.verifyProtocol(p); !errors.Is(err, ErrVerifyReadWriteMismatch) {
+		t.Errorf("expected %v, got %v", ErrVerifyReadWriteMismatch, err)
+	}
+}
+
+func TestVerify_NoWriteMethod(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "EntityLook", Fields: []Field{{Name: "bonesId", Type: "uint16"}}},
+		},
+		Messages: []Class{
+			{Name: "GameFightOptionStateUpdateMessage", ProtocolID: 5927, Fields: []Field{
+				{Name: "fightId", Type: "uint16", WriteMethod: "writeShort"},
+				{Name: "teamId", Type: "uint8"},
+				{Name: "state", Type: "bool", UseBBW: true},
+				{Name: "look", Type: "EntityLook"},
+			}},
+		},
+	}
+
+	err := Verify(p)
+	if !errors.Is(err, ErrVerifyScalarNoWrite) {
+		t.Fatalf("expected %v, got %v", ErrVerifyScalarNoWrite, err)
+	}
+	var e noWriteMethodError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected noWriteMethodError, got %T", err)
+	}
+	expected := []string{"EntityLook.bonesId", "GameFightOptionStateUpdateMessage.teamId"}
+	if !reflect.DeepEqual(e.fields, expected) {
+		t.Errorf("expected %v, got %v", expected, e.fields)
+	}
+}
+
+func TestVerify_UnknownType(t *testing.T) {
+	p := &Protocol{
+		Types: []Class{
+			{Name: "EntityLook", Fields: []Field{{Name: "bonesId", Type: "uint16", WriteMethod: "writeVarShort"}}},
+		},
+		Messages: []Class{
+			{Name: "ValidMessage", ProtocolID: 1, Fields: []Field{{Name: "look", Type: "EntityLook"}}},
+			{Name: "BrokenMessage", ProtocolID: 2, Fields: []Field{
+				{Name: "look", Type: "EntityLook"},
+				{Name: "infos", Type: "MissingInformations"},
+				{Name: "others", Type: "OtherInformations", IsVector: true, IsDynamicLength: true},
+			}},
+		},
+	}
+
+	err := Verify(p)
+	if !errors.Is(err, ErrVerifyUnknownType) {
+		t.Fatalf("expected %v, got %v", ErrVerifyUnknownType, err)
+	}
+	var e unknownTypesError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected unknownTypesError, got %T", err)
+	}
+	expected := []string{"BrokenMessage:infos (MissingInformations)", "BrokenMessage:others (OtherInformations)"}
+	if !reflect.DeepEqual(e.refs, expected) {
+		t.Errorf("expected %v, got %v", expected, e.refs)
+	}
+
+	p.Types = append(p.Types, Class{Name: "MissingInformations"}, Class{Name: "OtherInformations"})
+	if err = Verify(p); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
+
+func TestVerify_DuplicateProtocolID(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{
+			{Name: "HelloGameMessage", ProtocolID: 101},
+			{Name: "HelloConnectMessage", ProtocolID: 3},
+			{Name: "FakeHelloGameMessage", ProtocolID: 101},
+			{Name: "FakeHelloConnectMessage", ProtocolID: 3},
+			{Name: "OtherHelloGameMessage", ProtocolID: 101},
+		},
+	}
+
+	err := Verify(p)
+	if !errors.Is(err, ErrVerifyDuplicateProtocolID) {
+		t.Fatalf("expected %v, got %v", ErrVerifyDuplicateProtocolID, err)
+	}
+	expected := duplicateIDError{[]duplicateID{
+		{101, []string{"HelloGameMessage", "FakeHelloGameMessage", "OtherHelloGameMessage"}},
+		{3, []string{"HelloConnectMessage", "FakeHelloConnectMessage"}},
+	}}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+
+	p.Messages = p.Messages[:3]
+	p.Messages[2].ProtocolID = 102
+	if err = Verify(p); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	// abstract messages have no id
+	p.Messages = append(p.Messages,
+		Class{Name: "AbstractGameActionMessage", Abstract: true},
+		Class{Name: "AbstractPartyMessage", Abstract: true},
+	)
+	if err = Verify(p); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package d2protocolparser
+
+import "fmt"
+
+// String returns the version formatted as MAJOR.MINOR.RELEASE.REVISION.PATCH,
+// missing parts are written as 0
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d.%d", v.Major, v.Minor, v.Release, v.Revision, v.Patch)
+}
+
+// Compare returns -1 if v is older than other, 1 if v is newer than other
+// and 0 if both are the same version. A missing revision or patch is 0, so
+// it is older than any set one. The build type is not compared.
+func (v Version) Compare(other Version) int {
+	a := []uint{v.Major, v.Minor, v.Release, v.Revision, v.Patch}
+	b := []uint{other.Major, other.Minor, other.Release, other.Revision, other.Patch}
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Less reports whether v is older than other
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// Equal reports whether v and other are the same version, regardless of their
+// build type
+func (v Version) Equal(other Version) bool {
+	return v.Compare(other) == 0
+}
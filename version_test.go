@@ -0,0 +1,41 @@
+package d2protocolparser
+
+import "testing"
+
+func TestVersion_String(t *testing.T) {
+	v := Version{2, 42, 0, 1027565, 0, "RELEASE"}
+	if v.String() != "2.42.0.1027565.0" {
+		t.Errorf("expected 2.42.0.1027565.0, got %v", v.String())
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Version
+		b    Version
+		want int
+	}{
+		{"equal", Version{2, 42, 0, 1027565, 0, ""}, Version{2, 42, 0, 1027565, 0, ""}, 0},
+		{"major", Version{1, 42, 0, 1027565, 0, ""}, Version{2, 0, 0, 0, 0, ""}, -1},
+		{"minor", Version{2, 42, 0, 0, 0, ""}, Version{2, 39, 0, 117122, 0, ""}, 1},
+		{"release", Version{2, 42, 1, 0, 0, ""}, Version{2, 42, 2, 0, 0, ""}, -1},
+		{"revision", Version{2, 42, 0, 1027566, 0, ""}, Version{2, 42, 0, 1027565, 0, ""}, 1},
+		{"patch", Version{2, 42, 0, 1027565, 0, ""}, Version{2, 42, 0, 1027565, 1, ""}, -1},
+		{"missing revision", Version{2, 39, 0, 0, 0, ""}, Version{2, 39, 0, 117122, 0, ""}, -1},
+		{"build type", Version{2, 42, 0, 1027565, 0, "RELEASE"}, Version{2, 42, 0, 1027565, 0, "BETA"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Compare(tt.b); got != tt.want {
+				t.Errorf("Version.Compare() = %v, want %v", got, tt.want)
+			}
+			if got := tt.a.Less(tt.b); got != (tt.want < 0) {
+				t.Errorf("Version.Less() = %v, want %v", got, tt.want < 0)
+			}
+			if got := tt.a.Equal(tt.b); got != (tt.want == 0) {
+				t.Errorf("Version.Equal() = %v, want %v", got, tt.want == 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package d2protocolparser
+
+// Visitor is called by Walk for every enumeration, class and field of a
+// protocol
+type Visitor interface {
+	VisitEnum(e Enum)
+	VisitClass(c Class)
+	VisitField(c Class, f Field)
+}
+
+// Walk visits the enumerations, then the types and then the messages of p,
+// in order. Each class is visited before its own fields, inherited fields are
+// only visited with the class declaring them.
+func (p *Protocol) Walk(v Visitor) {
+	for _, e := range p.Enums {
+		v.VisitEnum(e)
+	}
+	for _, classes := range [][]Class{p.Types, p.Messages} {
+		for _, c := range classes {
+			v.VisitClass(c)
+			for _, f := range c.Fields {
+				v.VisitField(c, f)
+			}
+		}
+	}
+}
+
+// EachClass calls fn with every type and then every message of p, in order,
+// and stops at the first error which is returned. isMessage tells the section
+// of the class.
+func (p *Protocol) EachClass(fn func(c *Class, isMessage bool) error) error {
+	for i := range p.Types {
+		if err := fn(&p.Types[i], false); err != nil {
+			return err
+		}
+	}
+	for i := range p.Messages {
+		if err := fn(&p.Messages[i], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachEnum calls fn with every enumeration of p, in order, and stops at the
+// first error which is returned
+func (p *Protocol) EachEnum(fn func(e *Enum) error) error {
+	for i := range p.Enums {
+		if err := fn(&p.Enums[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package d2protocolparser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type recordVisitor struct {
+	visited      []string
+	writeMethods map[string]bool
+}
+
+func (v *recordVisitor) VisitEnum(e Enum) {
+	v.visited = append(v.visited, "enum "+e.Name)
+}
+
+func (v *recordVisitor) VisitClass(c Class) {
+	v.visited = append(v.visited, "class "+c.Name)
+}
+
+func (v *recordVisitor) VisitField(c Class, f Field) {
+	if f.WriteMethod != "" {
+		v.writeMethods[f.WriteMethod] = true
+	}
+}
+
+func TestProtocol_Walk(t *testing.T) {
+	v := &recordVisitor{writeMethods: map[string]bool{}}
+	goldenProtocol().Walk(v)
+
+	expected := []string{
+		"enum AlignmentSideEnum",
+		"class GameContextActorInformations",
+		"class KrosmasterFigure",
+		"class IdentificationMessage",
+		"class IdentificationSuccessWithLoginTokenMessage",
+		"class BasicCharactersListMessage",
+	}
+	if !reflect.DeepEqual(v.visited, expected) {
+		t.Errorf("expected %v, got %v", expected, v.visited)
+	}
+
+	var methods []string
+	for m := range v.writeMethods {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	expected = []string{"writeBoolean", "writeByte", "writeDouble", "writeShort", "writeUTF", "writeVarLong", "writeVarShort"}
+	if !reflect.DeepEqual(methods, expected) {
+		t.Errorf("expected %v, got %v", expected, methods)
+	}
+}
+
+func TestProtocol_EachClass(t *testing.T) {
+	p := &Protocol{
+		Messages: []Class{{Name: "HelloGameMessage"}, {Name: "HelloConnectMessage"}},
+		Types:    []Class{{Name: "EntityLook"}},
+	}
+
+	var visited []string
+	err := p.EachClass(func(c *Class, isMessage bool) error {
+		visited = append(visited, fmt.Sprintf("%v %v", c.Name, isMessage))
+		c.Namespace = "visited"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected := []string{"EntityLook false", "HelloGameMessage true", "HelloConnectMessage true"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("expected %v, got %v", expected, visited)
+	}
+	if p.Messages[1].Namespace != "visited" {
+		t.Errorf("expected the classes to be modified in place")
+	}
+
+	stop := errors.New("stop")
+	visited = nil
+	err = p.EachClass(func(c *Class, isMessage bool) error {
+		visited = append(visited, c.Name)
+		if isMessage {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(visited) != 2 {
+		t.Errorf("expected to stop at HelloGameMessage, got %v after %v", err, visited)
+	}
+}
+
+func TestProtocol_EachEnum(t *testing.T) {
+	p := &Protocol{Enums: []Enum{{Name: "AlignmentSideEnum"}, {Name: "AccessoryPreviewErrorEnum"}}}
+	stop := errors.New("stop")
+	var visited []string
+	err := p.EachEnum(func(e *Enum) error {
+		visited = append(visited, e.Name)
+		return stop
+	})
+	if err != stop || !reflect.DeepEqual(visited, []string{"AlignmentSideEnum"}) {
+		t.Errorf("expected to stop at AlignmentSideEnum, got %v after %v", err, visited)
+	}
+}